@@ -13,9 +13,11 @@ import (
 	"errors"
 	"fmt"
 	. "github.com/bmbstack/gopay/common"
+	"html"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,6 +26,9 @@ import (
 
 var clients map[string]*AlipayClient
 
+// 支付宝用户ID(buyer_id)，2088开头的16位数字，否则视为open_id
+var buyerIDRegexp = regexp.MustCompile(`^2088\d{12}$`)
+
 func init() {
 	clients = make(map[string]*AlipayClient)
 }
@@ -45,6 +50,8 @@ type AlipayClient struct {
 	AlipayPublicKey []byte // 支付宝RSA公钥
 	IsSandbox       bool   // 是否为沙盒环境
 	SignType        string // 签名类型，RSA和RSA2 (RSA=>PKCS1, RSA2=>PKCS8)
+
+	MicroPayPolling *MicroPayPolling // 条码支付轮询配置，为空时使用DefaultMicroPayPolling
 }
 
 func AddAlipayClient(key string, client *AlipayClient) {
@@ -61,6 +68,10 @@ func GetAlipayClient(key string) *AlipayClient {
 
 // Order 下单(生成支付参数) https://docs.open.alipay.com/api_1/alipay.trade.app.pay
 func (client *AlipayClient) Order(chargeParam *ChargeParam) (*ChargeObject, error) {
+	if strings.EqualFold(chargeParam.PayChannel, PayChannelAlipayBarCode) {
+		return client.MicroPay(chargeParam)
+	}
+
 	var requestUrl string
 	if client.IsSandbox {
 		requestUrl = SandboxApiDomain
@@ -76,29 +87,31 @@ func (client *AlipayClient) Order(chargeParam *ChargeParam) (*ChargeObject, erro
 	// 订单金额转换 (分=>元)
 	totalAmountYuan := fmt.Sprintf("%.2f", float64(chargeParam.TotalFee)/float64(100))
 
+	bizContent := map[string]interface{}{
+		"out_trade_no": chargeParam.OrderID,     // 商户订单号，64个字符以内、可包含字母、数字、下划线；需保证在商户端不重复
+		"total_amount": totalAmountYuan,         // 订单总金额，单位为元，精确到小数点后两位
+		"subject":      chargeParam.Description, // 订单标题
+	}
+	err := appendChargeOptions(bizContent, chargeParam)
+	if err != nil {
+		return nil, err
+	}
+
 	params := make(map[string]string)
 	params["notify_url"] = chargeParam.CallbackURL
 	if strings.EqualFold(chargeParam.PayChannel, PayChannelAlipayApp) {
 		params["method"] = ApiNameTradeAppPay
-		params["biz_content"] = Marshal(map[string]string{
-			"out_trade_no": chargeParam.OrderID,     // 商户订单号，64个字符以内、可包含字母、数字、下划线；需保证在商户端不重复
-			"total_amount": totalAmountYuan,         // 订单总金额，单位为元，精确到小数点后两位
-			"subject":      chargeParam.Description, // 订单标题
-			"product_code": DefaultProductCodeApp,   // 销售产品码，商家和支付宝签约的产品码
-		})
+		bizContent["product_code"] = DefaultProductCodeApp // 销售产品码，商家和支付宝签约的产品码
+		params["biz_content"] = Marshal(bizContent)
 		params = client.appendBasicParams(params)
 
 		// 支付参数
 		object.PayParam = MapToUrlValues(params).Encode()
 	} else if strings.EqualFold(chargeParam.PayChannel, PayChannelAlipayH5) {
 		params["method"] = ApiNameTradeWapPay
-		params["biz_content"] = Marshal(map[string]string{
-			"out_trade_no": chargeParam.OrderID,     // 商户订单号，64个字符以内、可包含字母、数字、下划线；需保证在商户端不重复
-			"total_amount": totalAmountYuan,         // 订单总金额，单位为元，精确到小数点后两位
-			"subject":      chargeParam.Description, // 订单标题
-			"product_code": DefaultProductCodeWap,   // 销售产品码，商家和支付宝签约的产品码
-			"quit_url":     chargeParam.ReturnURL,   // 用户付款中途退出返回商户网站的地址
-		})
+		bizContent["product_code"] = DefaultProductCodeWap // 销售产品码，商家和支付宝签约的产品码
+		bizContent["quit_url"] = chargeParam.ReturnURL     // 用户付款中途退出返回商户网站的地址
+		params["biz_content"] = Marshal(bizContent)
 		params = client.appendBasicParams(params)
 
 		hc := &http.Client{}
@@ -116,6 +129,67 @@ func (client *AlipayClient) Order(chargeParam *ChargeParam) (*ChargeObject, erro
 
 		// 支付参数
 		object.PayParam = resp.Request.URL.String()
+	} else if strings.EqualFold(chargeParam.PayChannel, PayChannelAlipayPC) {
+		params["method"] = ApiNameTradePagePay
+		params["return_url"] = chargeParam.ReturnURL      // 支付完成后跳转回商户网站的地址
+		bizContent["product_code"] = DefaultProductCodePC // 销售产品码，商家和支付宝签约的产品码
+		if IsNotEmpty(chargeParam.QrPayMode) {
+			bizContent["qr_pay_mode"] = chargeParam.QrPayMode // 扫码支付的方式
+			if chargeParam.QrCodeWidth > 0 {
+				bizContent["qrcode_width"] = chargeParam.QrCodeWidth // 自定义二维码宽度，qr_pay_mode=4时有效
+			}
+		}
+		params["biz_content"] = Marshal(bizContent)
+		params = client.appendBasicParams(params)
+
+		// 支付参数，由浏览器请求支付宝，不在下单时发起请求
+		params[Sign], _ = url.QueryUnescape(params[Sign])
+		if chargeParam.AutoSubmitForm {
+			object.PayParam = buildAutoSubmitForm(requestUrl, params)
+		} else {
+			object.PayParam = requestUrl + "?" + MapToUrlValues(params).Encode()
+		}
+	} else if strings.EqualFold(chargeParam.PayChannel, PayChannelAlipayQR) {
+		params["method"] = ApiNameTradePrecreate
+		params["app_auth_token"] = client.AppAuthToken
+		params["biz_content"] = Marshal(bizContent)
+		params = client.appendBasicParams(params)
+
+		var respObject *AlipayTradePrecreateResponse
+		err = client.postWithForm(requestUrl, params, &respObject)
+		if err != nil {
+			return nil, err
+		}
+		if !respObject.IsSuccess() {
+			return nil, errors.New(respObject.Msg())
+		}
+
+		// 二维码链接
+		object.QrCode = respObject.AlipayTradePrecreate.QrCode
+	} else if strings.EqualFold(chargeParam.PayChannel, PayChannelAlipayJsapi) {
+		params["method"] = ApiNameTradeCreate
+		params["app_auth_token"] = client.AppAuthToken
+		bizContent["product_code"] = DefaultProductCodeJsapi // 销售产品码，商家和支付宝签约的产品码
+		if buyerIDRegexp.MatchString(chargeParam.PayerID) {
+			bizContent["buyer_id"] = chargeParam.PayerID // 买家支付宝用户ID，2088开头的16位数字
+		} else {
+			bizContent["buyer_open_id"] = chargeParam.PayerID // 买家支付宝用户唯一标识open_id
+		}
+		params["biz_content"] = Marshal(bizContent)
+		params = client.appendBasicParams(params)
+
+		var respObject *AlipayTradeCreateResponse
+		err = client.postWithForm(requestUrl, params, &respObject)
+		if err != nil {
+			return nil, err
+		}
+		if !respObject.IsSuccess() {
+			return nil, errors.New(respObject.Msg())
+		}
+
+		// 支付参数，前端使用trade_no调起my.tradePay
+		object.ThirdOrderID = respObject.AlipayTradeCreate.TradeNo
+		object.PayParam = respObject.AlipayTradeCreate.TradeNo
 	} else {
 		return nil, errors.New(fmt.Sprintf("alipay not support pay channel: %s", chargeParam.PayChannel))
 	}
@@ -135,8 +209,9 @@ func (client *AlipayClient) OrderQuery(orderQueryParam *OrderQueryParam) (*Order
 	params := make(map[string]string)
 	params["method"] = ApiNameTradeQuery
 	params["app_auth_token"] = client.AppAuthToken //  查询订单、退款、退款查询需要使用，下单不需要
-	params["biz_content"] = Marshal(map[string]string{
-		"out_trade_no": orderQueryParam.OrderID, // 订单支付时传入的商户订单号
+	params["biz_content"] = Marshal(map[string]interface{}{
+		"out_trade_no":  orderQueryParam.OrderID,                           // 订单支付时传入的商户订单号
+		"query_options": []string{"fund_bill_list", "voucher_detail_list"}, // 查询选项，额外返回资金渠道和优惠券信息
 	})
 	params = client.appendBasicParams(params)
 
@@ -150,15 +225,60 @@ func (client *AlipayClient) OrderQuery(orderQueryParam *OrderQueryParam) (*Order
 	}
 
 	// OrderQueryObject
-	thirdOrderAmount, _ := strconv.ParseInt(respObject.AlipayTradeQuery.ReceiptAmount, 10, 64)
 	object := &OrderQueryObject{
 		OrderID:         respObject.AlipayTradeQuery.OutTradeNo,
 		Status:          mapTradeStateToStatus[respObject.AlipayTradeQuery.TradeStatus],
-		PayTime:         GetAliPayTime(respObject.AlipayTradeQuery.SendPayDate),
+		PayTime:         GetDateFullTime(respObject.AlipayTradeQuery.SendPayDate),
 		ThirdOrderID:    respObject.AlipayTradeQuery.TradeNo,
-		ThirdOrderFee:   thirdOrderAmount * 100, // 元=>分
+		ThirdOrderFee:   YuanToFen(respObject.AlipayTradeQuery.TotalAmount),    // 元=>分
+		CashFee:         YuanToFen(respObject.AlipayTradeQuery.BuyerPayAmount), // 元=>分
+		SettlementFee:   YuanToFen(respObject.AlipayTradeQuery.ReceiptAmount),  // 元=>分
 		OrderQueryParam: orderQueryParam,
 	}
+	object.Attach, err = url.QueryUnescape(respObject.AlipayTradeQuery.PassbackParams) // 下单时UrlEncode的回传参数
+	if err != nil {
+		return nil, err
+	}
+	object.Discounts = toDiscounts(respObject.AlipayTradeQuery.VoucherDetailList, respObject.AlipayTradeQuery.FundBillList)
+	for _, discount := range object.Discounts {
+		object.DiscountFee += discount.Fee
+	}
+	return object, nil
+}
+
+// CloseOrder 关闭订单 https://docs.open.alipay.com/api_1/alipay.trade.close
+func (client *AlipayClient) CloseOrder(closeOrderParam *CloseOrderParam) (*CloseOrderObject, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxApiDomain
+	} else {
+		requestUrl = ApiDomain
+	}
+
+	params := make(map[string]string)
+	params["method"] = ApiNameTradeClose
+	params["app_auth_token"] = client.AppAuthToken //  查询订单、退款、退款查询需要使用，下单不需要
+	params["biz_content"] = Marshal(map[string]string{
+		"out_trade_no": closeOrderParam.OrderID, // 订单支付时传入的商户订单号
+	})
+	params = client.appendBasicParams(params)
+
+	var respObject *AlipayTradeCloseResponse
+	err := client.postWithForm(requestUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if !respObject.IsSuccess() {
+		return nil, errors.New(respObject.Msg())
+	}
+
+	// CloseOrderObject
+	object := &CloseOrderObject{
+		OrderID:         closeOrderParam.OrderID,
+		Status:          OrderClosed,
+		ThirdOrderID:    respObject.AlipayTradeClose.TradeNo,
+		CloseOrderParam: closeOrderParam,
+	}
 	return object, nil
 }
 
@@ -212,6 +332,10 @@ func (client *AlipayClient) Refund(refundParam *RefundParam) (*RefundObject, err
 
 // RefundQuery 退款查询 https://docs.open.alipay.com/api_1/alipay.trade.fastpay.refund.query
 func (client *AlipayClient) RefundQuery(refundQueryParam *RefundQueryParam) (*RefundQueryObject, error) {
+	if IsEmpty(refundQueryParam.OrderID) || IsEmpty(refundQueryParam.RefundID) {
+		return nil, errors.New("alipay refund query, orderID and refundID are required")
+	}
+
 	var requestUrl string
 	if client.IsSandbox {
 		requestUrl = SandboxApiDomain
@@ -278,6 +402,124 @@ var mapTradeStateToStatus = map[string]int64{
 	"TRADE_FINISHED": OrderFinishedCanNotRefund, // 11: 订单已完成，不能退款
 }
 
+// 下单可选参数，biz_content中的订单失效时间、回传参数和禁用渠道，支付宝没有对应字段的微信参数直接报错
+func appendChargeOptions(bizContent map[string]interface{}, chargeParam *ChargeParam) error {
+	if chargeParam.ExpireTime != nil {
+		if !chargeParam.ExpireTime.After(time.Now()) {
+			return errors.New("alipay time_expire must be after now")
+		}
+		bizContent["time_expire"] = FormatPayTime(*chargeParam.ExpireTime, DateMinuteLayout) // 绝对超时时间，格式为yyyy-MM-dd HH:mm
+	}
+	if IsNotEmpty(chargeParam.GoodsTag) {
+		return errors.New("alipay not supported goodsTag")
+	}
+	if chargeParam.Receipt {
+		return errors.New("alipay not supported receipt")
+	}
+	if IsNotEmpty(chargeParam.Attach) {
+		bizContent["passback_params"] = url.QueryEscape(chargeParam.Attach) // 公用回传参数，需要UrlEncode，异步通知时原样返回
+	}
+	if chargeParam.NoCredit {
+		bizContent["disable_pay_channels"] = "credit_group" // 禁用渠道，credit_group包含信用卡、花呗等信用支付渠道
+	}
+	if chargeParam.OrderDetail != nil {
+		if chargeParam.OrderDetail.GoodsTotalFee() != chargeParam.TotalFee { // 商品金额合计需要等于total_amount，不使用微信的订单原价
+			return errors.New("orderDetail, goods total fee not equal to totalFee")
+		}
+		bizContent["goods_detail"] = toGoodsDetail(chargeParam.OrderDetail) // 订单包含的商品列表信息
+	}
+	return nil
+}
+
+// 商品列表，金额单位为元
+func toGoodsDetail(orderDetail *OrderDetail) []map[string]interface{} {
+	var goodsDetail []map[string]interface{}
+	for _, goods := range orderDetail.GoodsDetail {
+		item := map[string]interface{}{
+			"goods_id":   goods.GoodsID,                                          // 商品的编号
+			"goods_name": goods.GoodsName,                                        // 商品名称
+			"quantity":   goods.Quantity,                                         // 商品数量
+			"price":      fmt.Sprintf("%.2f", float64(goods.Price)/float64(100)), // 商品单价，单位为元
+		}
+		if IsNotEmpty(goods.ThirdGoodsID) {
+			item["alipay_goods_id"] = goods.ThirdGoodsID // 支付宝定义的统一商品编号
+		}
+		if IsNotEmpty(goods.GoodsCategory) {
+			item["goods_category"] = goods.GoodsCategory // 商品类目
+		}
+		if IsNotEmpty(goods.Body) {
+			item["body"] = goods.Body // 商品描述信息
+		}
+		if IsNotEmpty(goods.ShowURL) {
+			item["show_url"] = goods.ShowURL // 商品的展示地址
+		}
+		goodsDetail = append(goodsDetail, item)
+	}
+	return goodsDetail
+}
+
+// 自动提交的HTML表单，商户页面直接输出后跳转到支付宝
+func buildAutoSubmitForm(requestUrl string, params map[string]string) string {
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf(`<form id="alipaysubmit" name="alipaysubmit" action="%s?charset=utf-8" method="POST">`, requestUrl))
+	for _, k := range keys {
+		builder.WriteString(fmt.Sprintf(`<input type="hidden" name="%s" value="%s"/>`, html.EscapeString(k), html.EscapeString(params[k])))
+	}
+	builder.WriteString(`<input type="submit" value="ok" style="display:none;"/></form>`)
+	builder.WriteString(`<script>document.forms['alipaysubmit'].submit();</script>`)
+	return builder.String()
+}
+
+// 资金渠道中的优惠渠道，未返回优惠券信息时使用，true为商户出资
+var mapFundChannelToMerchant = map[string]bool{
+	"COUPON":    false, // 支付宝红包
+	"DISCOUNT":  false, // 折扣券
+	"MCOUPON":   true,  // 商户红包
+	"MDISCOUNT": true,  // 商户优惠券
+}
+
+// 优惠明细，优先使用优惠券信息，没有优惠券信息时使用资金渠道中的优惠渠道，避免重复计算
+func toDiscounts(voucherDetails []*VoucherDetail, fundBills []*FundBill) []*Discount {
+	var discounts []*Discount
+	for _, voucher := range voucherDetails {
+		discounts = append(discounts, &Discount{
+			ID:          voucher.Id,
+			Type:        voucher.Type,
+			Name:        voucher.Name,
+			Fee:         YuanToFen(voucher.Amount),
+			MerchantFee: YuanToFen(voucher.MerchantContribute),
+			OtherFee:    YuanToFen(voucher.OtherContribute),
+		})
+	}
+	if len(discounts) > 0 {
+		return discounts
+	}
+
+	for _, fundBill := range fundBills {
+		isMerchant, ok := mapFundChannelToMerchant[fundBill.FundChannel]
+		if !ok {
+			continue
+		}
+		discount := &Discount{
+			Type: fundBill.FundChannel,
+			Fee:  YuanToFen(fundBill.Amount),
+		}
+		if isMerchant {
+			discount.MerchantFee = discount.Fee
+		} else {
+			discount.OtherFee = discount.Fee
+		}
+		discounts = append(discounts, discount)
+	}
+	return discounts
+}
+
 // method, biz_content 自定义
 func (client *AlipayClient) appendBasicParams(params map[string]string) map[string]string {
 	params["app_id"] = client.AppID                         // 支付宝分配给开发者的应用ID
@@ -317,27 +559,48 @@ func (client *AlipayClient) postWithForm(url string, params map[string]string, r
 		var rootIndex = strings.LastIndex(bodyStr, rootNodeName)
 		var errorIndex = strings.LastIndex(bodyStr, RespError)
 
+		var nodeName string
 		var data string
 		var sign string
 		if rootIndex > 0 {
+			nodeName = rootNodeName
 			data, sign = parseJSONSource(bodyStr, rootNodeName, rootIndex)
 		} else if errorIndex > 0 {
+			nodeName = RespError
 			data, sign = parseJSONSource(bodyStr, RespError, errorIndex)
 		} else {
-			return nil
+			return errors.New(fmt.Sprintf("alipay response node not found: %s", rootNodeName))
 		}
 
+		// 网关错误(如40001、40002)不签名，按返回码处理；业务成功的响应必须签名
 		if IsNotEmpty(sign) {
 			err = client.checkSign(data, sign)
 			if err != nil {
 				return err
 			}
+		} else if parseResponseCode(respBody, nodeName) == RespSuccessCode {
+			return errors.New("alipay response sign is empty")
 		}
 	}
 
 	return json.Unmarshal(respBody, respObject)
 }
 
+// 响应节点中的返回码
+func parseResponseCode(respBody []byte, nodeName string) string {
+	var nodes map[string]json.RawMessage
+	if json.Unmarshal(respBody, &nodes) != nil {
+		return ""
+	}
+	var node struct {
+		Code string `json:"code"`
+	}
+	if json.Unmarshal(nodes[nodeName], &node) != nil {
+		return ""
+	}
+	return node.Code
+}
+
 func parseJSONSource(bodyStr string, nodeName string, nodeIndex int) (content string, sign string) {
 	var dataStartIndex = nodeIndex + len(nodeName) + 2
 	var signIndex = strings.LastIndex(bodyStr, "\""+Sign+"\"")
@@ -352,6 +615,9 @@ func parseJSONSource(bodyStr string, nodeName string, nodeIndex int) (content st
 	var signStartIndex = signIndex + len(Sign) + 4
 	sign = bodyStr[signStartIndex:]
 	var signEndIndex = strings.LastIndex(sign, "\"}")
+	if signEndIndex < 0 {
+		return content, ""
+	}
 	sign = sign[:signEndIndex]
 
 	return content, sign
@@ -449,6 +715,8 @@ func (client *AlipayClient) checkSign(data string, sign string) error {
 		if err != nil {
 			return errors.New("verify fail")
 		}
+	default:
+		return errors.New(fmt.Sprintf("alipay not support sign type: %s", client.SignType))
 	}
 	return nil
 }
@@ -0,0 +1,67 @@
+package alipay
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostWithFormSign(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &AlipayClient{
+		AlipayPublicKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes}),
+		SignType:        SignTypeRSA2,
+	}
+	sign := func(content string) string {
+		hashed := sha256.Sum256([]byte(content))
+		signBytes, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(signBytes)
+	}
+
+	success := `{"code":"10000","msg":"Success","out_trade_no":"T20201017001","trade_status":"TRADE_SUCCESS"}`
+	tests := []struct {
+		name     string
+		body     string
+		wantErr  bool
+		wantCode string
+	}{
+		{"signed success", `{"alipay_trade_query_response":` + success + `,"sign":"` + sign(success) + `"}`, false, RespSuccessCode},
+		{"tampered success", `{"alipay_trade_query_response":` + success + `,"sign":"` + sign(`{"code":"10000"}`) + `"}`, true, ""},
+		{"unsigned success", `{"alipay_trade_query_response":` + success + `}`, true, ""},
+		{"unsigned gateway error", `{"alipay_trade_query_response":{"code":"40002","msg":"Invalid Arguments","sub_code":"isv.invalid-app-id","sub_msg":"无效的AppID参数"}}`, false, "40002"},
+		{"missing node", `{"other_response":{"code":"10000"}}`, true, ""},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tt.body))
+		}))
+
+		var respObject *AlipayTradeQueryResponse
+		err := client.postWithForm(server.URL, map[string]string{"method": ApiNameTradeQuery}, &respObject)
+		server.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && respObject.AlipayTradeQuery.Code != tt.wantCode {
+			t.Errorf("%s: code = %s, want %s", tt.name, respObject.AlipayTradeQuery.Code, tt.wantCode)
+		}
+	}
+}
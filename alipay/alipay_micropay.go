@@ -0,0 +1,188 @@
+package alipay
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/bmbstack/gopay/common"
+	"time"
+)
+
+// MicroPay 当面付条码支付 https://docs.open.alipay.com/api_1/alipay.trade.pay
+// 等待用户付款(10003)时按MicroPayPolling轮询查询订单，超时仍未支付成功则撤销订单；
+// 结果未知(20000)或请求失败时先查询订单，仍未支付成功才撤销订单；
+// 支付失败或撤销失败时，同时返回带最终状态的ChargeObject和错误
+func (client *AlipayClient) MicroPay(chargeParam *ChargeParam) (*ChargeObject, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxApiDomain
+	} else {
+		requestUrl = ApiDomain
+	}
+
+	bizContent := map[string]interface{}{
+		"out_trade_no": chargeParam.OrderID,                                             // 商户订单号，64个字符以内、可包含字母、数字、下划线；需保证在商户端不重复
+		"total_amount": fmt.Sprintf("%.2f", float64(chargeParam.TotalFee)/float64(100)), // 订单总金额，单位为元，精确到小数点后两位
+		"subject":      chargeParam.Description,                                         // 订单标题
+		"scene":        "bar_code",                                                      // 支付场景，条码支付
+		"auth_code":    chargeParam.AuthCode,                                            // 支付授权码，用户支付宝中的付款码
+	}
+	err := appendChargeOptions(bizContent, chargeParam)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string)
+	params["method"] = ApiNameTradePay
+	params["app_auth_token"] = client.AppAuthToken
+	params["notify_url"] = chargeParam.CallbackURL
+	params["biz_content"] = Marshal(bizContent)
+	params = client.appendBasicParams(params)
+
+	// ChargeObject
+	object := &ChargeObject{}
+	object.ChargeParam = chargeParam
+
+	var respObject *AlipayTradePayResponse
+	err = client.postWithForm(requestUrl, params, &respObject)
+	if err == nil {
+		switch respObject.AlipayTradePay.Code {
+		case RespSuccessCode: // 支付成功
+			object.Status = OrderPaidSuccess
+			object.ThirdOrderID = respObject.AlipayTradePay.TradeNo
+			return object, nil
+		case RespPayingCode: // 等待用户付款
+			return client.waitMicroPay(object)
+		case RespUnknownCode: // 结果未知，查询订单确认支付结果
+		default: // 支付失败
+			object.Status = OrderPaidFail
+			return object, errors.New(respObject.Msg())
+		}
+	}
+
+	return client.confirmMicroPay(object)
+}
+
+// Cancel 撤销订单 https://docs.open.alipay.com/api_1/alipay.trade.cancel
+// 请求失败或撤销失败且retry_flag=Y时，按MicroPayPolling.ReverseRetry重试
+func (client *AlipayClient) Cancel(orderQueryParam *OrderQueryParam) (*AlipayTradeCancelResponse, error) {
+	polling := client.getMicroPayPolling()
+	for i := 0; ; i++ {
+		respObject, err := client.cancel(orderQueryParam)
+		if err == nil {
+			if respObject.IsSuccess() {
+				return respObject, nil
+			}
+			if respObject.AlipayTradeCancel.RetryFlag != "Y" {
+				return nil, errors.New(respObject.Msg())
+			}
+			err = errors.New(respObject.Msg())
+		}
+		if i >= polling.ReverseRetry {
+			return nil, err
+		}
+		time.Sleep(polling.Interval)
+	}
+}
+
+// 轮询查询订单，直到支付成功、交易关闭或超时，超时仍未支付成功时撤销订单
+func (client *AlipayClient) waitMicroPay(object *ChargeObject) (*ChargeObject, error) {
+	polling := client.getMicroPayPolling()
+	deadline := time.Now().Add(polling.Timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(polling.Interval)
+
+		queryObject, err := client.OrderQuery(microPayOrderQueryParam(object))
+		if err != nil { // 交易不存在或查询失败，继续查询
+			continue
+		}
+		if isMicroPayPaid(queryObject) {
+			object.Status = OrderPaidSuccess
+			object.ThirdOrderID = queryObject.ThirdOrderID
+			return object, nil
+		}
+		if queryObject.Status != OrderWaitPay { // 交易已关闭
+			break
+		}
+	}
+
+	return client.cancelMicroPay(object)
+}
+
+// 支付结果未知时查询一次订单，已支付成功时直接返回，等待付款时继续轮询，其他情况撤销订单
+func (client *AlipayClient) confirmMicroPay(object *ChargeObject) (*ChargeObject, error) {
+	queryObject, err := client.OrderQuery(microPayOrderQueryParam(object))
+	if err == nil {
+		if isMicroPayPaid(queryObject) {
+			object.Status = OrderPaidSuccess
+			object.ThirdOrderID = queryObject.ThirdOrderID
+			return object, nil
+		}
+		if queryObject.Status == OrderWaitPay {
+			return client.waitMicroPay(object)
+		}
+	}
+
+	return client.cancelMicroPay(object)
+}
+
+// 撤销条码支付订单，用户已支付时撤销会产生退款
+// 撤销失败时支付结果未知，返回用户支付中状态和错误，由调用方继续查询或撤销
+func (client *AlipayClient) cancelMicroPay(object *ChargeObject) (*ChargeObject, error) {
+	respObject, err := client.Cancel(microPayOrderQueryParam(object))
+	if err != nil {
+		object.Status = OrderUserPaying // 3: 支付结果未知
+		return object, err
+	}
+	object.ThirdOrderID = respObject.AlipayTradeCancel.TradeNo
+	if respObject.AlipayTradeCancel.Action == "refund" {
+		object.Status = OrderToRefund // 6: 用户已支付，撤销产生了退款
+	} else {
+		object.Status = OrderClosed // 10: 交易已关闭
+	}
+	return object, nil
+}
+
+func microPayOrderQueryParam(object *ChargeObject) *OrderQueryParam {
+	return &OrderQueryParam{
+		PayType:    PayTypeAlipay,
+		PayChannel: PayChannelAlipayBarCode,
+		OrderID:    object.ChargeParam.OrderID,
+	}
+}
+
+// 交易支付成功(TRADE_SUCCESS)或交易结束不可退款(TRADE_FINISHED)都表示用户已支付
+func isMicroPayPaid(queryObject *OrderQueryObject) bool {
+	return queryObject.Status == OrderPaidSuccess || queryObject.Status == OrderFinishedCanNotRefund
+}
+
+// 撤销订单，业务失败时同时返回响应，由调用方根据retry_flag判断是否重试
+func (client *AlipayClient) cancel(orderQueryParam *OrderQueryParam) (*AlipayTradeCancelResponse, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxApiDomain
+	} else {
+		requestUrl = ApiDomain
+	}
+
+	params := make(map[string]string)
+	params["method"] = ApiNameTradeCancel
+	params["app_auth_token"] = client.AppAuthToken
+	params["biz_content"] = Marshal(map[string]string{
+		"out_trade_no": orderQueryParam.OrderID, // 原支付请求的商户订单号
+	})
+	params = client.appendBasicParams(params)
+
+	var respObject *AlipayTradeCancelResponse
+	err := client.postWithForm(requestUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return respObject, nil
+}
+
+func (client *AlipayClient) getMicroPayPolling() *MicroPayPolling {
+	if client.MicroPayPolling != nil {
+		return client.MicroPayPolling
+	}
+	return DefaultMicroPayPolling
+}
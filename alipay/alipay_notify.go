@@ -0,0 +1,163 @@
+package alipay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/bmbstack/gopay/common"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	NotifyReplySuccess = "success" // 通知处理成功时返回给支付宝的内容
+	NotifyReplyFail    = "failure" // 通知处理失败时返回给支付宝的内容，支付宝会按策略重新通知
+)
+
+// NotifyReply 根据通知处理结果生成返回给支付宝的内容
+func NotifyReply(err error) string {
+	if err != nil {
+		return NotifyReplyFail
+	}
+	return NotifyReplySuccess
+}
+
+// 异步通知中fund_bill_list、voucher_detail_list的字段为驼峰命名
+type notifyFundBill struct {
+	FundChannel string `json:"fundChannel"`
+	Amount      string `json:"amount"`
+	RealAmount  string `json:"realAmount"`
+}
+
+type notifyVoucherDetail struct {
+	Id                 string `json:"id"`
+	Name               string `json:"name"`
+	Type               string `json:"type"`
+	Amount             string `json:"amount"`
+	MerchantContribute string `json:"merchantContribute"`
+	OtherContribute    string `json:"otherContribute"`
+	Memo               string `json:"memo"`
+}
+
+// ParseNotify 解析异步通知 https://docs.open.alipay.com/204/105301/
+func (client *AlipayClient) ParseNotify(r *http.Request) (*AlipayTradeNotify, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, err
+	}
+	return client.ParseNotifyForm(r.PostForm)
+}
+
+// ParseNotifyForm 解析异步通知，form为支付宝POST的表单参数
+func (client *AlipayClient) ParseNotifyForm(form url.Values) (*AlipayTradeNotify, error) {
+	params := make(map[string]string)
+	for k := range form {
+		params[k] = form.Get(k)
+	}
+
+	if IsEmpty(client.AlipayPublicKey) {
+		return nil, errors.New("alipay public key is empty")
+	}
+
+	// 使用支付宝RSA公钥按client.SignType验证签名，待签名字符串不包含sign和sign_type
+	// 不使用通知中的sign_type，避免被指定为更弱的签名算法
+	err := client.checkSign(notifySignContent(params), params[Sign])
+	if err != nil {
+		return nil, err
+	}
+	if params["app_id"] != client.AppID {
+		return nil, errors.New(fmt.Sprintf("alipay notify app_id not match: %s", params["app_id"]))
+	}
+	status, ok := mapTradeStateToStatus[params["trade_status"]]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown trade_status: %s", params["trade_status"]))
+	}
+
+	notify := &AlipayTradeNotify{
+		NotifyTime:     GetDateFullTime(params["notify_time"]),
+		NotifyType:     params["notify_type"],
+		NotifyID:       params["notify_id"],
+		AppID:          params["app_id"],
+		Charset:        params["charset"],
+		Version:        params["version"],
+		SignType:       params["sign_type"],
+		TradeNo:        params["trade_no"],
+		OutTradeNo:     params["out_trade_no"],
+		OutBizNo:       params["out_biz_no"],
+		BuyerID:        params["buyer_id"],
+		BuyerLogonID:   params["buyer_logon_id"],
+		SellerID:       params["seller_id"],
+		SellerEmail:    params["seller_email"],
+		TradeStatus:    params["trade_status"],
+		TotalAmount:    YuanToFen(params["total_amount"]),
+		ReceiptAmount:  YuanToFen(params["receipt_amount"]),
+		InvoiceAmount:  YuanToFen(params["invoice_amount"]),
+		BuyerPayAmount: YuanToFen(params["buyer_pay_amount"]),
+		PointAmount:    YuanToFen(params["point_amount"]),
+		RefundFee:      YuanToFen(params["refund_fee"]),
+		Subject:        params["subject"],
+		Body:           params["body"],
+		GmtCreate:      GetDateFullTime(params["gmt_create"]),
+		GmtPayment:     GetDateFullTime(params["gmt_payment"]),
+		GmtRefund:      GetDateFullTime(params["gmt_refund"]),
+		GmtClose:       GetDateFullTime(params["gmt_close"]),
+		Status:         status,
+	}
+
+	if IsNotEmpty(params["passback_params"]) {
+		notify.PassbackParams, err = url.QueryUnescape(params["passback_params"])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if IsNotEmpty(params["fund_bill_list"]) {
+		var fundBills []*notifyFundBill
+		err = json.Unmarshal([]byte(params["fund_bill_list"]), &fundBills)
+		if err != nil {
+			return nil, err
+		}
+		for _, fundBill := range fundBills {
+			realAmount, _ := strconv.ParseFloat(fundBill.RealAmount, 64)
+			notify.FundBillList = append(notify.FundBillList, &FundBill{
+				FundChannel: fundBill.FundChannel,
+				Amount:      fundBill.Amount,
+				RealAmount:  realAmount,
+			})
+		}
+	}
+	if IsNotEmpty(params["voucher_detail_list"]) {
+		var voucherDetails []*notifyVoucherDetail
+		err = json.Unmarshal([]byte(params["voucher_detail_list"]), &voucherDetails)
+		if err != nil {
+			return nil, err
+		}
+		for _, voucher := range voucherDetails {
+			notify.VoucherDetailList = append(notify.VoucherDetailList, &VoucherDetail{
+				Id:                 voucher.Id,
+				Name:               voucher.Name,
+				Type:               voucher.Type,
+				Amount:             voucher.Amount,
+				MerchantContribute: voucher.MerchantContribute,
+				OtherContribute:    voucher.OtherContribute,
+				Memo:               voucher.Memo,
+			})
+		}
+	}
+	return notify, nil
+}
+
+// 异步通知待签名字符串，除去sign、sign_type和空值参数后按参数名排序
+func notifySignContent(params map[string]string) string {
+	var paramArray []string
+	for k, v := range params {
+		if k == Sign || k == "sign_type" || v == "" {
+			continue
+		}
+		paramArray = append(paramArray, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(paramArray)
+	return strings.Join(paramArray, "&")
+}
@@ -0,0 +1,113 @@
+package alipay
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	. "github.com/bmbstack/gopay/common"
+	"net/url"
+	"testing"
+)
+
+func TestNotifySignContent(t *testing.T) {
+	params := map[string]string{
+		"trade_status": "TRADE_SUCCESS",
+		"app_id":       "2014072300007148",
+		"sign":         "xxx",
+		"sign_type":    "RSA2",
+		"body":         "",
+		"out_trade_no": "T20201017001",
+	}
+	want := "app_id=2014072300007148&out_trade_no=T20201017001&trade_status=TRADE_SUCCESS"
+	if got := notifySignContent(params); got != want {
+		t.Errorf("notifySignContent = %q, want %q", got, want)
+	}
+}
+
+func TestParseNotifyForm(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &AlipayClient{
+		AppID:           "2014072300007148",
+		AlipayPublicKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes}),
+		SignType:        SignTypeRSA2,
+	}
+
+	newParams := func() map[string]string {
+		return map[string]string{
+			"notify_time":     "2020-10-17 12:30:50",
+			"notify_type":     "trade_status_sync",
+			"notify_id":       "ac05099524730693a8b330c5ecf72da9786",
+			"app_id":          client.AppID,
+			"trade_no":        "2020101722001401234567890123",
+			"out_trade_no":    "T20201017001",
+			"trade_status":    "TRADE_SUCCESS",
+			"total_amount":    "2.00",
+			"gmt_payment":     "2020-10-17 12:30:45",
+			"passback_params": url.QueryEscape("a=1&b=2"),
+		}
+	}
+	sign := func(params map[string]string, signType string) url.Values {
+		content := []byte(notifySignContent(params))
+		var signBytes []byte
+		var err error
+		if signType == SignTypeRSA {
+			hashed := sha1.Sum(content)
+			signBytes, err = rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA1, hashed[:])
+		} else {
+			hashed := sha256.Sum256(content)
+			signBytes, err = rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		form := url.Values{}
+		for k, v := range params {
+			form.Set(k, v)
+		}
+		form.Set("sign_type", signType)
+		form.Set(Sign, base64.StdEncoding.EncodeToString(signBytes))
+		return form
+	}
+
+	notify, err := client.ParseNotifyForm(sign(newParams(), SignTypeRSA2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notify.Status != OrderPaidSuccess || notify.TotalAmount != 200 || notify.PassbackParams != "a=1&b=2" ||
+		notify.GmtPayment.Format("2006-01-02 15:04:05") != "2020-10-17 12:30:45" {
+		t.Errorf("unexpected notify: %+v", notify)
+	}
+
+	tamperedForm := sign(newParams(), SignTypeRSA2)
+	tamperedForm.Set("total_amount", "0.01")
+	otherAppParams := newParams()
+	otherAppParams["app_id"] = "2014072300007149"
+	unknownStatusParams := newParams()
+	unknownStatusParams["trade_status"] = "TRADE_UNKNOWN"
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{"tampered", tamperedForm},
+		{"sign_type downgrade", sign(newParams(), SignTypeRSA)},
+		{"app_id", sign(otherAppParams, SignTypeRSA2)},
+		{"trade_status", sign(unknownStatusParams, SignTypeRSA2)},
+	}
+	for _, tt := range tests {
+		if _, err := client.ParseNotifyForm(tt.form); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
@@ -1,16 +1,22 @@
 package alipay
 
+import "time"
+
 const (
-	SignTypeRSA           = "RSA"                 // 1024位, RSA => pkcs1格式
-	SignTypeRSA2          = "RSA2"                // 2048位, RSA2 => pkcs8格式
-	DefaultProductCodeApp = "QUICK_MSECURITY_PAY" // product code
-	DefaultProductCodeWap = "QUICK_WAP_WAY"       // product code
+	SignTypeRSA             = "RSA"                    // 1024位, RSA => pkcs1格式
+	SignTypeRSA2            = "RSA2"                   // 2048位, RSA2 => pkcs8格式
+	DefaultProductCodeApp   = "QUICK_MSECURITY_PAY"    // product code
+	DefaultProductCodeWap   = "QUICK_WAP_WAY"          // product code
+	DefaultProductCodePC    = "FAST_INSTANT_TRADE_PAY" // product code
+	DefaultProductCodeJsapi = "JSAPI_PAY"              // product code
 
 	Sign       = "sign"
 	RespSuffix = "_response"
 	RespError  = "error_response"
 
 	RespSuccessCode = "10000"
+	RespPayingCode  = "10003" // 条码支付等待用户付款
+	RespUnknownCode = "20000" // 服务不可用，结果未知
 
 	MIMEApplicationForm = "application/x-www-form-urlencoded;charset=utf-8" // Content-Type
 
@@ -21,11 +27,129 @@ const (
 
 	ApiNameTradeAppPay      = "alipay.trade.app.pay"              // APP下订单，生成支付参数
 	ApiNameTradeWapPay      = "alipay.trade.wap.pay"              // 手机网站下订单，生成支付参数
+	ApiNameTradePagePay     = "alipay.trade.page.pay"             // 电脑网站下订单，生成支付链接或表单
+	ApiNameTradePrecreate   = "alipay.trade.precreate"            // 当面付预下单，生成二维码
+	ApiNameTradePay         = "alipay.trade.pay"                  // 当面付条码支付
+	ApiNameTradeCreate      = "alipay.trade.create"               // 统一收单交易创建，小程序支付
+	ApiNameTradeCancel      = "alipay.trade.cancel"               // 撤销订单
 	ApiNameTradeQuery       = "alipay.trade.query"                // 订单查询
+	ApiNameTradeClose       = "alipay.trade.close"                // 关闭订单
 	ApiNameTradeRefund      = "alipay.trade.refund"               // 退款
 	ApiNameTradeRefundQuery = "alipay.trade.fastpay.refund.query" // 退款查询
 )
 
+//=================================================================
+//							[Response]预下单
+//=================================================================
+type AlipayTradePrecreateResponse struct {
+	AlipayTradePrecreate struct {
+		Code       string `json:"code"`
+		Msg        string `json:"msg"`
+		SubCode    string `json:"sub_code"`
+		SubMsg     string `json:"sub_msg"`
+		OutTradeNo string `json:"out_trade_no"` // 商家订单号
+		QrCode     string `json:"qr_code"`      // 当前预下单请求生成的二维码码串
+	} `json:"alipay_trade_precreate_response"`
+	Sign string `json:"sign"`
+}
+
+func (this *AlipayTradePrecreateResponse) IsSuccess() bool {
+	if this.AlipayTradePrecreate.Code == RespSuccessCode {
+		return true
+	}
+	return false
+}
+
+func (this *AlipayTradePrecreateResponse) Msg() string {
+	return this.AlipayTradePrecreate.Msg + ", " + this.AlipayTradePrecreate.SubMsg
+}
+
+//=================================================================
+//							[Response]交易创建
+//=================================================================
+type AlipayTradeCreateResponse struct {
+	AlipayTradeCreate struct {
+		Code       string `json:"code"`
+		Msg        string `json:"msg"`
+		SubCode    string `json:"sub_code"`
+		SubMsg     string `json:"sub_msg"`
+		OutTradeNo string `json:"out_trade_no"` // 商家订单号
+		TradeNo    string `json:"trade_no"`     // 支付宝交易号
+	} `json:"alipay_trade_create_response"`
+	Sign string `json:"sign"`
+}
+
+func (this *AlipayTradeCreateResponse) IsSuccess() bool {
+	if this.AlipayTradeCreate.Code == RespSuccessCode {
+		return true
+	}
+	return false
+}
+
+func (this *AlipayTradeCreateResponse) Msg() string {
+	return this.AlipayTradeCreate.Msg + ", " + this.AlipayTradeCreate.SubMsg
+}
+
+//=================================================================
+//							[Response]条码支付
+//=================================================================
+type AlipayTradePayResponse struct {
+	AlipayTradePay struct {
+		Code          string      `json:"code"`
+		Msg           string      `json:"msg"`
+		SubCode       string      `json:"sub_code"`
+		SubMsg        string      `json:"sub_msg"`
+		TradeNo       string      `json:"trade_no"`                 // 支付宝交易号
+		OutTradeNo    string      `json:"out_trade_no"`             // 商家订单号
+		BuyerLogonId  string      `json:"buyer_logon_id"`           // 买家支付宝账号
+		BuyerUserId   string      `json:"buyer_user_id"`            // 买家在支付宝的用户id
+		TotalAmount   string      `json:"total_amount"`             // 交易金额
+		ReceiptAmount string      `json:"receipt_amount"`           // 实收金额
+		GmtPayment    string      `json:"gmt_payment"`              // 交易支付时间
+		FundBillList  []*FundBill `json:"fund_bill_list,omitempty"` // 交易支付使用的资金渠道
+	} `json:"alipay_trade_pay_response"`
+	Sign string `json:"sign"`
+}
+
+func (this *AlipayTradePayResponse) IsSuccess() bool {
+	if this.AlipayTradePay.Code == RespSuccessCode {
+		return true
+	}
+	return false
+}
+
+func (this *AlipayTradePayResponse) Msg() string {
+	return this.AlipayTradePay.Msg + ", " + this.AlipayTradePay.SubMsg
+}
+
+//=================================================================
+//							[Response]撤销订单
+//=================================================================
+type AlipayTradeCancelResponse struct {
+	AlipayTradeCancel struct {
+		Code       string `json:"code"`
+		Msg        string `json:"msg"`
+		SubCode    string `json:"sub_code"`
+		SubMsg     string `json:"sub_msg"`
+		TradeNo    string `json:"trade_no"`     // 支付宝交易号
+		OutTradeNo string `json:"out_trade_no"` // 商家订单号
+		RetryFlag  string `json:"retry_flag"`   // 是否需要重试 Y/N
+		Action     string `json:"action"`       // 本次撤销触发的交易动作 close：关闭交易，无退款；refund：产生了退款
+	} `json:"alipay_trade_cancel_response"`
+	Sign string `json:"sign"`
+}
+
+func (this *AlipayTradeCancelResponse) IsSuccess() bool {
+	if this.AlipayTradeCancel.Code == RespSuccessCode {
+		return true
+	}
+	return false
+}
+
+func (this *AlipayTradeCancelResponse) Msg() string {
+	return this.AlipayTradeCancel.Msg + ", " + this.AlipayTradeCancel.SubMsg
+}
+
 //=================================================================
 //							[Response]查询订单
 //=================================================================
@@ -47,6 +171,7 @@ type AlipayTradeQueryResponse struct {
 		SendPayDate      string `json:"send_pay_date"`       // 本次交易打款给卖家的时间
 		TotalAmount      string `json:"total_amount"`        // 交易的订单金额
 		TradeNo          string `json:"trade_no"`            // 支付宝交易号
+		PassbackParams   string `json:"passback_params"`     // 公用回传参数，下单时传入的passback_params，已UrlEncode
 		TradeStatus      string `json:"trade_status"`        // 交易状态：WAIT_BUYER_PAY（交易创建，等待买家付款）、TRADE_CLOSED（未付款交易超时关闭，或支付完成后全额退款）、TRADE_SUCCESS（交易支付成功）、TRADE_FINISHED（交易结束，不可退款）
 
 		DiscountAmount      string           `json:"discount_amount"`               // 平台优惠金额
@@ -96,6 +221,32 @@ func (this *AlipayTradeQueryResponse) Msg() string {
 	return this.AlipayTradeQuery.Msg + ", " + this.AlipayTradeQuery.SubMsg
 }
 
+//=================================================================
+//							[Response]关闭订单
+//=================================================================
+type AlipayTradeCloseResponse struct {
+	AlipayTradeClose struct {
+		Code       string `json:"code"`
+		Msg        string `json:"msg"`
+		SubCode    string `json:"sub_code"`
+		SubMsg     string `json:"sub_msg"`
+		TradeNo    string `json:"trade_no"`     // 支付宝交易号
+		OutTradeNo string `json:"out_trade_no"` // 商家订单号
+	} `json:"alipay_trade_close_response"`
+	Sign string `json:"sign"`
+}
+
+func (this *AlipayTradeCloseResponse) IsSuccess() bool {
+	if this.AlipayTradeClose.Code == RespSuccessCode {
+		return true
+	}
+	return false
+}
+
+func (this *AlipayTradeCloseResponse) Msg() string {
+	return this.AlipayTradeClose.Msg + ", " + this.AlipayTradeClose.SubMsg
+}
+
 //=================================================================
 //							[Response]退款
 //=================================================================
@@ -164,3 +315,42 @@ func (this *AlipayFastpayTradeRefundQueryResponse) IsSuccess() bool {
 func (this *AlipayFastpayTradeRefundQueryResponse) Msg() string {
 	return this.AlipayTradeRefundQuery.Msg + ", " + this.AlipayTradeRefundQuery.SubMsg
 }
+
+//=================================================================
+//							[Notify]异步通知
+//=================================================================
+// AlipayTradeNotify 支付宝异步通知，金额单位为分
+type AlipayTradeNotify struct {
+	NotifyTime        *time.Time       // 通知的发送时间
+	NotifyType        string           // 通知类型 trade_status_sync
+	NotifyID          string           // 通知校验ID
+	AppID             string           // 支付宝分配给开发者的应用ID
+	Charset           string           // 编码格式
+	Version           string           // 接口版本
+	SignType          string           // 签名类型 RSA/RSA2
+	TradeNo           string           // 支付宝交易号
+	OutTradeNo        string           // 商户订单号
+	OutBizNo          string           // 商户业务号，主要是退款通知中返回退款申请的流水号
+	BuyerID           string           // 买家支付宝用户号
+	BuyerLogonID      string           // 买家支付宝账号
+	SellerID          string           // 卖家支付宝用户号
+	SellerEmail       string           // 卖家支付宝账号
+	TradeStatus       string           // 交易状态 WAIT_BUYER_PAY/TRADE_CLOSED/TRADE_SUCCESS/TRADE_FINISHED
+	TotalAmount       int64            // 订单金额
+	ReceiptAmount     int64            // 实收金额
+	InvoiceAmount     int64            // 开票金额
+	BuyerPayAmount    int64            // 付款金额
+	PointAmount       int64            // 集分宝金额
+	RefundFee         int64            // 总退款金额
+	Subject           string           // 订单标题
+	Body              string           // 商品描述
+	GmtCreate         *time.Time       // 交易创建时间
+	GmtPayment        *time.Time       // 交易付款时间
+	GmtRefund         *time.Time       // 交易退款时间
+	GmtClose          *time.Time       // 交易结束时间
+	FundBillList      []*FundBill      // 支付成功的各个渠道金额信息
+	VoucherDetailList []*VoucherDetail // 本交易支付时所使用的所有优惠券信息
+	PassbackParams    string           // 回传参数，下单时的Attach，已UrlDecode
+
+	Status int64 // 支付状态，由trade_status映射
+}
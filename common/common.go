@@ -6,6 +6,7 @@ import "time"
 
 const (
 	PayTypeWx     = "wx"     // 微信支付
+	PayTypeWxV3   = "wxv3"   // 微信支付(APIv3)
 	PayTypeAlipay = "alipay" // 支付宝支付
 )
 const (
@@ -15,10 +16,15 @@ const (
 	PayChannelWxApp    = "APP"      // App支付（Android端使用）
 	PayChannelWxH5     = "MWEB"     // H5支付（iOS端使用），因为苹果审核禁止微信App支付
 	PayChannelWxJsapi  = "JSAPI"    // JSAPI支付（公众号支付，小程序支付）
+	PayChannelWxPap    = "PAP"      // 委托代扣，使用签约成功后的ContractID申请扣款
 
 	// 支付宝支付渠道
-	PayChannelAlipayApp = "APP"
-	PayChannelAlipayH5  = "H5"
+	PayChannelAlipayApp     = "APP"
+	PayChannelAlipayH5      = "H5"
+	PayChannelAlipayPC      = "PC"       // 电脑网站支付
+	PayChannelAlipayQR      = "QR"       // 当面付扫码支付，商户展示二维码，用户扫码支付
+	PayChannelAlipayBarCode = "BAR_CODE" // 当面付条码支付，商户扫用户付款码
+	PayChannelAlipayJsapi   = "JSAPI"    // JSAPI支付（小程序支付），返回trade_no供前端调起my.tradePay
 )
 
 const (
@@ -36,6 +42,12 @@ const (
 	OrderFinishedCanNotRefund        // 11 订单已完成，不能退款
 )
 
+// SubMerchant 微信服务商模式下的子商户
+type SubMerchant struct {
+	SubAppID string `json:"subAppID,omitempty"` // 子商户公众账号ID，微信分配的子商户公众账号ID
+	SubMchID string `json:"subMchID,omitempty"` // 子商户号，微信支付分配的子商户号
+}
+
 //========================================
 //              Charge Order
 //========================================
@@ -45,14 +57,63 @@ type ChargeParam struct {
 	PayChannel  string `json:"payChannel,omitempty" validate:"required"`  // 支付渠道
 	CallbackURL string `json:"callbackURL,omitempty" validate:"required"` // 支付回调地址
 
+	SubMerchant // 【微信服务商】子商户，为空时使用WxClient上配置的子商户
+
 	OrderID     string `json:"orderID,omitempty" validate:"required"`     // 本地订单号
 	TotalFee    int64  `json:"totalFee,omitempty" validate:"required"`    // 订单总金额 单位：分
 	Description string `json:"description,omitempty" validate:"required"` // 订单描述
 	ClientIP    string `json:"clientIP,omitempty" validate:"required"`    // 用户端实际ip
 
-	OpenID    string `json:"openID,omitempty"`    // 微信openid
-	SceneInfo string `json:"sceneInfo,omitempty"` // 微信对H5支付有以下三种场景, iOS移动应用, Android移动应用, WAP网站应用
-	ReturnURL string `json:"returnURL,omitempty"` // 支付结果页, 阿里quit_url, 用户付款中途退出返回商户网站的地址
+	OpenID     string `json:"openID,omitempty"`     // 微信openid
+	PayerID    string `json:"payerID,omitempty"`    // 付款用户标识，微信为openid(OpenID为空时使用)，支付宝为2088开头的user_id或open_id
+	SubOpenID  string `json:"subOpenID,omitempty"`  // 【微信服务商】用户在子商户sub_appid下的openid，JSAPI传入时使用sub_appid调起支付
+	SceneInfo  string `json:"sceneInfo,omitempty"`  // 微信对H5支付有以下三种场景, iOS移动应用, Android移动应用, WAP网站应用
+	ProductID  string `json:"productID,omitempty"`  // 【微信NATIVE】商品ID，扫码支付模式一回调时为二维码中的商品ID
+	ReturnURL  string `json:"returnURL,omitempty"`  // 支付结果页, 阿里quit_url, 用户付款中途退出返回商户网站的地址
+	AuthCode   string `json:"authCode,omitempty"`   // 付款码, 付款码支付时必传, 扫码设备读取用户微信中的条码或者二维码信息
+	ContractID string `json:"contractID,omitempty"` // 【微信】委托代扣协议id，委托代扣时必传，签约成功后由微信返回
+
+	ProfitSharing bool `json:"profitSharing,omitempty"` // 【微信】是否需要分账，需要分账的订单支付成功后资金会被冻结，直到分账完结
+
+	ExpireTime *time.Time `json:"expireTime,omitempty"` // 订单失效时间，微信要求距下单时间不少于5分钟
+	Attach     string     `json:"attach,omitempty"`     // 附加数据，支付通知和订单查询中原样返回，微信attach，支付宝passback_params
+	GoodsTag   string     `json:"goodsTag,omitempty"`   // 【微信】订单优惠标记，使用代金券或立减优惠功能时需要的参数，支付宝不支持
+	NoCredit   bool       `json:"noCredit,omitempty"`   // 禁止使用信用卡，微信limit_pay=no_credit，支付宝disable_pay_channels=credit_group
+	Receipt    bool       `json:"receipt,omitempty"`    // 【微信】支付成功消息和支付详情页中出现开票入口，支付宝不支持
+
+	OrderDetail *OrderDetail `json:"orderDetail,omitempty"` // 商品详情，单品优惠时使用，商品金额合计需等于订单原价或TotalFee
+
+	QrPayMode      string `json:"qrPayMode,omitempty"`      // 【支付宝PC】扫码支付的方式 0/1/2/3/4，为空时跳转到支付宝收银台
+	QrCodeWidth    int64  `json:"qrCodeWidth,omitempty"`    // 【支付宝PC】qr_pay_mode=4时的二维码宽度
+	AutoSubmitForm bool   `json:"autoSubmitForm,omitempty"` // 【支付宝PC】PayParam返回自动提交的HTML表单，默认返回GET请求的URL
+}
+
+// OrderDetail 商品详情
+type OrderDetail struct {
+	CostPrice   int64          `json:"costPrice,omitempty"`   // 【微信】订单原价，单位：分，商户侧一张小票订单可能被分多次支付，订单原价用于记录整张小票的交易金额
+	ReceiptID   string         `json:"receiptID,omitempty"`   // 【微信】商品小票ID
+	GoodsDetail []*GoodsDetail `json:"goodsDetail,omitempty"` // 商品列表
+}
+
+// GoodsDetail 单品信息
+type GoodsDetail struct {
+	GoodsID       string `json:"goodsID,omitempty"`       // 商品编码，由半角的大小写字母、数字、中划线、下划线中的一种或几种组成
+	ThirdGoodsID  string `json:"thirdGoodsID,omitempty"`  // 第三方统一商品编号，微信wxpay_goods_id，支付宝alipay_goods_id
+	GoodsName     string `json:"goodsName,omitempty"`     // 商品名称
+	Quantity      int64  `json:"quantity,omitempty"`      // 商品数量
+	Price         int64  `json:"price,omitempty"`         // 商品单价，单位：分
+	GoodsCategory string `json:"goodsCategory,omitempty"` // 【支付宝】商品类目
+	Body          string `json:"body,omitempty"`          // 【支付宝】商品描述信息
+	ShowURL       string `json:"showURL,omitempty"`       // 【支付宝】商品的展示地址
+}
+
+// GoodsTotalFee 商品金额合计，单位：分
+func (detail *OrderDetail) GoodsTotalFee() int64 {
+	var totalFee int64
+	for _, goods := range detail.GoodsDetail {
+		totalFee += goods.Price * goods.Quantity
+	}
+	return totalFee
 }
 
 // ChargeObject
@@ -62,12 +123,29 @@ type ChargeObject struct {
 	PrepayID string `json:"prepayID,omitempty"` //【微信】预支付交易会话标识 微信生成的预支付回话标识，用于后续接口调用中使用，该值有效期为2小时,针对H5支付此参数无特殊用途
 	CodeURL  string `json:"codeURL,omitempty"`  //【微信】二维码链接 trade_type=NATIVE时有返回，此url用于生成支付二维码，然后提供给用户进行扫码支付。
 	MWebURL  string `json:"mwebURL,omitempty"`  //【微信】支付跳转链接 mweb_url为拉起微信支付收银台的中间页面，可通过访问该url来拉起微信客户端，完成支付,mweb_url的有效期为5分钟
+	QrCode   string `json:"qrCode,omitempty"`   //【支付宝】当面付二维码链接，商户将此链接生成二维码后展示给用户扫码支付
+
+	ThirdOrderID string `json:"thirdOrderID,omitempty"` // 第三方订单单号(微信，支付宝)，付款码支付成功、支付宝JSAPI下单时返回
 
 	ChargeParam *ChargeParam `json:"chargeParam,omitempty"`
 
 	PayParam string `json:"payParam,omitempty"` // Android/iOS客户端支付时需要的参数
 }
 
+// MicroPayPolling 付款码支付轮询配置，用户支付中或支付结果未知时轮询查询订单，超时后撤销订单
+type MicroPayPolling struct {
+	Interval     time.Duration // 查询订单的间隔
+	Timeout      time.Duration // 等待用户支付的超时时间，超时后撤销订单
+	ReverseRetry int           // 撤销订单失败且需要重试时的最大重试次数
+}
+
+// DefaultMicroPayPolling 默认每5秒查询一次，30秒后撤销订单，撤销最多重试3次
+var DefaultMicroPayPolling = &MicroPayPolling{
+	Interval:     5 * time.Second,
+	Timeout:      30 * time.Second,
+	ReverseRetry: 3,
+}
+
 //========================================
 //              OrderQuery
 //========================================
@@ -75,6 +153,8 @@ type OrderQueryParam struct {
 	PayType    string `json:"payType,omitempty" validate:"required"`    // 支付方式
 	PayChannel string `json:"payChannel,omitempty" validate:"required"` // 支付渠道
 
+	SubMerchant // 【微信服务商】子商户，为空时使用WxClient上配置的子商户
+
 	OrderID string `json:"orderID,omitempty" validate:"required"` // 本地订单号
 }
 
@@ -86,10 +166,49 @@ type OrderQueryObject struct {
 
 	ThirdOrderID  string `json:"thirdOrderID,omitempty"`  // 第三方订单单号(微信，支付宝)
 	ThirdOrderFee int64  `json:"thirdOrderFee,omitempty"` // 第三方订单金额，单位：分(微信，支付宝)
+	Attach        string `json:"attach,omitempty"`        // 下单时传入的附加数据，微信attach，支付宝passback_params
+
+	CashFee       int64       `json:"cashFee,omitempty"`       // 用户实际支付金额，单位：分
+	SettlementFee int64       `json:"settlementFee,omitempty"` // 应结订单金额，订单金额扣除商户出资的优惠，单位：分
+	DiscountFee   int64       `json:"discountFee,omitempty"`   // 优惠总金额，单位：分
+	Discounts     []*Discount `json:"discounts,omitempty"`     // 优惠明细
 
 	OrderQueryParam *OrderQueryParam `json:"orderQueryParam,omitempty"`
 }
 
+// Discount 订单优惠明细
+type Discount struct {
+	ID          string `json:"id,omitempty"`          // 优惠券ID
+	Type        string `json:"type,omitempty"`        // 优惠类型，微信: CASH/NO_CASH(APIv3为NOCASH)，支付宝: 券类型或资金渠道
+	Name        string `json:"name,omitempty"`        // 优惠名称
+	Fee         int64  `json:"fee,omitempty"`         // 优惠金额，单位：分
+	MerchantFee int64  `json:"merchantFee,omitempty"` // 商户出资金额，单位：分
+	OtherFee    int64  `json:"otherFee,omitempty"`    // 微信、支付宝或其他出资方出资金额，单位：分
+}
+
+//========================================
+//              CloseOrder
+//========================================
+// CloseOrderParam
+type CloseOrderParam struct {
+	PayType    string `json:"payType,omitempty" validate:"required"`    // 支付方式
+	PayChannel string `json:"payChannel,omitempty" validate:"required"` // 支付渠道
+
+	SubMerchant // 【微信服务商】子商户，为空时使用WxClient上配置的子商户
+
+	OrderID string `json:"orderID,omitempty" validate:"required"` // 本地订单号
+}
+
+// CloseOrderObject
+type CloseOrderObject struct {
+	OrderID string `json:"orderID,omitempty"` // 本地订单号
+	Status  int64  `json:"status,omitempty"`  // 支付状态， 关闭成功为10: 订单已关闭
+
+	ThirdOrderID string `json:"thirdOrderID,omitempty"` // 第三方订单单号(支付宝)
+
+	CloseOrderParam *CloseOrderParam `json:"closeOrderParam,omitempty"`
+}
+
 //========================================
 //              Refund
 //========================================
@@ -99,6 +218,8 @@ type RefundParam struct {
 	PayChannel  string `json:"payChannel,omitempty" validate:"required"`  // 支付渠道
 	CallbackURL string `json:"callbackURL,omitempty" validate:"required"` // 支付回调地址
 
+	SubMerchant // 【微信服务商】子商户，为空时使用WxClient上配置的子商户
+
 	OrderID    string `json:"orderID,omitempty" validate:"required"`    // 本地订单号
 	OrderFee   int64  `json:"orderFee,omitempty" validate:"required"`   // 订单总金额 单位：分
 	RefundID   string `json:"refundID,omitempty" validate:"required"`   // 本地退款号
@@ -129,8 +250,15 @@ type RefundQueryParam struct {
 	PayType    string `json:"payType,omitempty" validate:"required"`    // 支付方式
 	PayChannel string `json:"payChannel,omitempty" validate:"required"` // 支付渠道
 
-	OrderID  string `json:"orderID,omitempty" validate:"required"`  // 本地订单号
-	RefundID string `json:"refundID,omitempty" validate:"required"` // 本地退款号
+	SubMerchant // 【微信服务商】子商户，为空时使用WxClient上配置的子商户
+
+	// 微信可按以下任一单号查询，优先级 ThirdRefundID > RefundID > ThirdOrderID > OrderID; 支付宝需要OrderID和RefundID
+	OrderID       string `json:"orderID,omitempty"`       // 本地订单号
+	RefundID      string `json:"refundID,omitempty"`      // 本地退款号
+	ThirdOrderID  string `json:"thirdOrderID,omitempty"`  // 第三方订单单号(微信)
+	ThirdRefundID string `json:"thirdRefundID,omitempty"` // 第三方退款单号(微信)
+
+	Offset int64 `json:"offset,omitempty"` // 偏移量(微信)，订单部分退款超过10笔时使用，返回第offset+1到offset+10笔退款
 }
 
 // RefundQueryObject
@@ -145,5 +273,36 @@ type RefundQueryObject struct {
 	ThirdRefundID  string `json:"thirdRefundID,omitempty"`  // 第三方退款单号(微信，支付宝)
 	ThirdRefundFee int64  `json:"thirdRefundFee,omitempty"` // 第三方退款金额，单位：分(微信，支付宝)
 
+	SettlementRefundFee int64      `json:"settlementRefundFee,omitempty"` // 退款金额-非充值代金券退款金额，单位：分(微信)
+	RefundTime          *time.Time `json:"refundTime,omitempty"`          // 退款成功时间
+	RefundRecvAccount   string     `json:"refundRecvAccount,omitempty"`   // 退款入账账户，如：招商银行信用卡0403、支付用户零钱
+
+	TotalRefundCount int64              `json:"totalRefundCount,omitempty"` // 订单总共已发生的部分退款次数(微信)，传入Offset时返回
+	Refunds          []*RefundQueryItem `json:"refunds,omitempty"`          // 订单的全部部分退款(微信)
+
 	RefundQueryParam *RefundQueryParam `json:"refundQueryParam,omitempty"`
 }
+
+// RefundQueryItem 单笔退款
+type RefundQueryItem struct {
+	RefundID string `json:"refundID,omitempty"` // 本地退款号
+	Status   int64  `json:"status,omitempty"`   // 退款状态， 7: 退款中, 8: 退款成功, 9: 退款失败
+
+	ThirdRefundID       string `json:"thirdRefundID,omitempty"`       // 第三方退款单号
+	ThirdRefundFee      int64  `json:"thirdRefundFee,omitempty"`      // 申请退款金额，单位：分
+	SettlementRefundFee int64  `json:"settlementRefundFee,omitempty"` // 退款金额-非充值代金券退款金额，单位：分
+	CouponRefundFee     int64  `json:"couponRefundFee,omitempty"`     // 代金券退款总金额，单位：分
+
+	RefundChannel     string     `json:"refundChannel,omitempty"`     // 退款渠道 ORIGINAL—原路退款, BALANCE—退回到余额
+	RefundRecvAccount string     `json:"refundRecvAccount,omitempty"` // 退款入账账户
+	RefundTime        *time.Time `json:"refundTime,omitempty"`        // 退款成功时间
+
+	Coupons []*RefundCoupon `json:"coupons,omitempty"` // 代金券退款明细
+}
+
+// RefundCoupon 代金券退款
+type RefundCoupon struct {
+	CouponID        string `json:"couponID,omitempty"`        // 退款代金券ID
+	CouponType      string `json:"couponType,omitempty"`      // 代金券类型 CASH—充值代金券, NO_CASH—非充值优惠券
+	CouponRefundFee int64  `json:"couponRefundFee,omitempty"` // 单个退款代金券支付金额，单位：分
+}
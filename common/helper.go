@@ -2,11 +2,17 @@ package common
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/tls"
 	"encoding/json"
 	"encoding/pem"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/pkcs12"
+	"io"
+	"math"
 	"net/url"
 	"reflect"
 	"runtime"
@@ -19,6 +25,7 @@ const (
 	DateShortLayout            = "2006-01-02"
 	DateFullLayout             = "2006-01-02 15:04:05"
 	DateFullLayoutWithoutSplit = "20060102150405"
+	DateMinuteLayout           = "2006-01-02 15:04"
 	TimeLocationName           = "Asia/Shanghai"
 )
 
@@ -146,6 +153,44 @@ func MapToXml(params map[string]string) string {
 	return buf.String()
 }
 
+// XmlToMap 将<xml>下的一级节点解析成map
+func XmlToMap(xmlStr string) (map[string]string, error) {
+	params := make(map[string]string)
+	decoder := xml.NewDecoder(strings.NewReader(xmlStr))
+
+	var depth int
+	var key string
+	var value strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				key = t.Name.Local
+				value.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				params[key] = value.String()
+			}
+			depth--
+		}
+	}
+	return params, nil
+}
+
 // NonceStr 用时间戳生成随机字符串
 func NonceStr() string {
 	return strconv.FormatInt(time.Now().UTC().UnixNano(), 10)
@@ -194,6 +239,15 @@ func MapToUrlValues(params map[string]string) url.Values {
 	return values
 }
 
+// YuanToFen 将单位为元的金额转换成分，如"0.01" => 1，格式错误时返回0
+func YuanToFen(yuan string) int64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(yuan), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(value * 100))
+}
+
 // GetWxPayTime 获取微信支付时间 格式为yyyyMMddHHmmss
 func GetWxPayTime(timeEnd string) *time.Time {
 	var payTime time.Time
@@ -206,10 +260,62 @@ func GetWxPayTime(timeEnd string) *time.Time {
 
 // GetAliPayTime 获取支付宝支付时间 格式为yyyy-MM-dd HH:mm:ss 2006-01-02 15:04:05
 func GetAliPayTime(timeEnd string) *time.Time {
-	var payTime time.Time
-	if IsNotEmpty(timeEnd) {
+	return GetDateFullTime(timeEnd)
+}
+
+// GetDateFullTime 获取格式为yyyy-MM-dd HH:mm:ss的时间，如微信退款成功时间、支付宝支付时间
+func GetDateFullTime(value string) *time.Time {
+	var result time.Time
+	if IsNotEmpty(value) {
 		location, _ := time.LoadLocation(TimeLocationName)
-		payTime, _ = time.ParseInLocation(DateFullLayout, timeEnd, location)
+		result, _ = time.ParseInLocation(DateFullLayout, value, location)
 	}
-	return &payTime
+	return &result
+}
+
+// FormatPayTime 按北京时间格式化，如微信time_expire、支付宝time_expire
+func FormatPayTime(t time.Time, layout string) string {
+	location, _ := time.LoadLocation(TimeLocationName)
+	return t.In(location).Format(layout)
+}
+
+// AesEcbDecrypt AES-ECB解密，并去除PKCS7填充
+func AesEcbDecrypt(data []byte, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := block.BlockSize()
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, errors.New("aes ecb decrypt: data is not a multiple of the block size")
+	}
+
+	result := make([]byte, len(data))
+	for start := 0; start < len(data); start += blockSize {
+		block.Decrypt(result[start:start+blockSize], data[start:start+blockSize])
+	}
+
+	padding := int(result[len(result)-1])
+	if padding == 0 || padding > blockSize || padding > len(result) {
+		return nil, errors.New("aes ecb decrypt: invalid padding")
+	}
+	for _, b := range result[len(result)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("aes ecb decrypt: invalid padding")
+		}
+	}
+	return result[:len(result)-padding], nil
+}
+
+// AesGcmDecrypt AES-GCM解密，ciphertext末尾包含认证标签，如微信支付APIv3的AEAD_AES_256_GCM
+func AesGcmDecrypt(key []byte, nonce []byte, associatedData []byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, ciphertext, associatedData)
 }
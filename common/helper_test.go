@@ -0,0 +1,91 @@
+package common
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+// 不做填充的AES-ECB加密，用于构造解密用例
+func aesEcbEncryptRaw(t *testing.T, plain []byte, key []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make([]byte, len(plain))
+	for start := 0; start < len(plain); start += block.BlockSize() {
+		block.Encrypt(result[start:start+block.BlockSize()], plain[start:start+block.BlockSize()])
+	}
+	return result
+}
+
+func TestAesEcbDecrypt(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	vector, _ := base64.StdEncoding.DecodeString("pZwJZBLuy3mDACEQT4YTBw==") // "hello" + PKCS7
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"vector", vector, []byte("hello"), false},
+		{"full padding block", aesEcbEncryptRaw(t, append([]byte("0123456789abcdef"), bytes.Repeat([]byte{16}, 16)...), key), []byte("0123456789abcdef"), false},
+		{"empty", nil, nil, true},
+		{"not block size", vector[:15], nil, true},
+		{"zero padding", aesEcbEncryptRaw(t, append([]byte("0123456789abcde"), 0), key), nil, true},
+		{"padding too large", aesEcbEncryptRaw(t, append([]byte("0123456789abcde"), 17), key), nil, true},
+		{"inconsistent padding", aesEcbEncryptRaw(t, append([]byte("0123456789abc"), 1, 2, 3), key), nil, true},
+	}
+	for _, tt := range tests {
+		got, err := AesEcbDecrypt(tt.data, key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAesGcmDecrypt(t *testing.T) {
+	// AES-256-GCM测试向量(GCM规范Test Case 16)，与AEAD_AES_256_GCM相同
+	key, _ := hex.DecodeString("feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308")
+	nonce, _ := hex.DecodeString("cafebabefacedbaddecaf888")
+	associatedData, _ := hex.DecodeString("feedfacedeadbeeffeedfacedeadbeefabaddad2")
+	plain, _ := hex.DecodeString("d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39")
+	ciphertext, _ := hex.DecodeString("522dc1f099567d07f47f37a32a84427d643a8cdcbfe5c0c97598a2bd2555d1aa8cb08e48590dbb3da7b08b1056828838c5f61e6393ba7a0abcc9f662" +
+		"76fc6ece0f4e1768cddf8853bb2d551b")
+
+	tamperedData := append([]byte{}, associatedData...)
+	tamperedData[0] ^= 1
+	tamperedCiphertext := append([]byte{}, ciphertext...)
+	tamperedCiphertext[0] ^= 1
+
+	tests := []struct {
+		name           string
+		key            []byte
+		associatedData []byte
+		ciphertext     []byte
+		want           []byte
+		wantErr        bool
+	}{
+		{"vector", key, associatedData, ciphertext, plain, false},
+		{"tampered associated data", key, tamperedData, ciphertext, nil, true},
+		{"tampered ciphertext", key, associatedData, tamperedCiphertext, nil, true},
+		{"invalid key size", key[:31], associatedData, ciphertext, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := AesGcmDecrypt(tt.key, nonce, tt.associatedData, tt.ciphertext)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
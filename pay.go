@@ -19,6 +19,7 @@ func init() {
 type PayClient interface {
 	Order(chargeParam *ChargeParam) (*ChargeObject, error)
 	OrderQuery(orderQueryParam *OrderQueryParam) (*OrderQueryObject, error)
+	CloseOrder(closeOrderParam *CloseOrderParam) (*CloseOrderObject, error)
 	Refund(refundParam *RefundParam) (*RefundObject, error)
 	RefundQuery(refundQueryParam *RefundQueryParam) (*RefundQueryObject, error)
 }
@@ -30,27 +31,52 @@ func Order(clientKey string, param *ChargeParam) (*ChargeObject, error) {
 		return nil, err
 	}
 
-	if strings.EqualFold(param.PayChannel, PayChannelWxJsapi) && IsEmpty(param.OpenID) {
-		return nil, errors.New("JSAPI, openID is NULL")
+	if strings.EqualFold(param.PayType, PayTypeAlipay) {
+		if strings.EqualFold(param.PayChannel, PayChannelAlipayJsapi) && IsEmpty(param.PayerID) {
+			return nil, errors.New("JSAPI, payerID is NULL")
+		}
+	} else if strings.EqualFold(param.PayChannel, PayChannelWxJsapi) && IsEmpty(param.OpenID) && IsEmpty(param.SubOpenID) && IsEmpty(param.PayerID) {
+		return nil, errors.New("JSAPI, openID and payerID is NULL")
+	}
+	if strings.EqualFold(param.PayChannel, PayChannelWxMicro) && IsEmpty(param.AuthCode) {
+		return nil, errors.New("MICROPAY, authCode is NULL")
+	}
+	if strings.EqualFold(param.PayChannel, PayChannelAlipayBarCode) && IsEmpty(param.AuthCode) {
+		return nil, errors.New("BAR_CODE, authCode is NULL")
+	}
+	if strings.EqualFold(param.PayChannel, PayChannelWxPap) && IsEmpty(param.ContractID) {
+		return nil, errors.New("PAP, contractID is NULL")
 	}
 
+	// 付款码支付失败时同时返回带最终状态的ChargeObject和错误
 	pc := getPayClient(clientKey, param.PayType)
-	object, err := pc.Order(param)
+	return pc.Order(param)
+}
+
+// OrderQuery
+func OrderQuery(clientKey string, param *OrderQueryParam) (*OrderQueryObject, error) {
+	err := validate.Struct(param)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := getPayClient(clientKey, param.PayType)
+	object, err := pc.OrderQuery(param)
 	if err != nil {
 		return nil, err
 	}
 	return object, err
 }
 
-// OrderQuery
-func OrderQuery(clientKey string, param *OrderQueryParam) (*OrderQueryObject, error) {
+// CloseOrder
+func CloseOrder(clientKey string, param *CloseOrderParam) (*CloseOrderObject, error) {
 	err := validate.Struct(param)
 	if err != nil {
 		return nil, err
 	}
 
 	pc := getPayClient(clientKey, param.PayType)
-	object, err := pc.OrderQuery(param)
+	object, err := pc.CloseOrder(param)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +105,10 @@ func RefundQuery(clientKey string, param *RefundQueryParam) (*RefundQueryObject,
 		return nil, err
 	}
 
+	if IsEmpty(param.OrderID) && IsEmpty(param.RefundID) && IsEmpty(param.ThirdOrderID) && IsEmpty(param.ThirdRefundID) {
+		return nil, errors.New("orderID, refundID, thirdOrderID and thirdRefundID are all NULL")
+	}
+
 	pc := getPayClient(clientKey, param.PayType)
 	object, err := pc.RefundQuery(param)
 	if err != nil {
@@ -92,6 +122,8 @@ func getPayClient(clientKey string, payType string) PayClient {
 	switch payType {
 	case PayTypeWx:
 		pc = wx.GetWxClient(clientKey)
+	case PayTypeWxV3:
+		pc = wx.GetWxV3Client(clientKey)
 	case PayTypeAlipay:
 		pc = alipay.GetAlipayClient(clientKey)
 	default:
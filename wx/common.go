@@ -1,5 +1,11 @@
 package wx
 
+import (
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+	"time"
+)
+
 const (
 	Fail    = "FAIL"
 	Success = "SUCCESS"
@@ -10,6 +16,10 @@ const (
 
 	MIMEApplicationXML = "application/xml; charset=utf-8"
 
+	BillTypeAll     = "ALL"     // 对账单类型，当日所有订单信息（不含充值退款订单）
+	BillTypeSuccess = "SUCCESS" // 对账单类型，当日成功支付的订单（不含充值退款订单）
+	BillTypeRefund  = "REFUND"  // 对账单类型，当日退款订单（不含充值退款订单）
+
 	MicroPayUrl         = "https://api.mch.weixin.qq.com/pay/micropay"
 	UnifiedOrderUrl     = "https://api.mch.weixin.qq.com/pay/unifiedorder"
 	OrderQueryUrl       = "https://api.mch.weixin.qq.com/pay/orderquery"
@@ -33,6 +43,16 @@ const (
 	SandboxReportUrl           = "https://api.mch.weixin.qq.com/sandboxnew/payitil/report"
 	SandboxShortUrl            = "https://api.mch.weixin.qq.com/sandboxnew/tools/shorturl"
 	SandboxAuthCodeToOpenidUrl = "https://api.mch.weixin.qq.com/sandboxnew/tools/authcodetoopenid"
+	SandboxGetSignKeyUrl       = "https://api.mch.weixin.qq.com/sandboxnew/pay/getsignkey"
+
+	sandboxSignKeyTTL = 30 * time.Minute // 沙盒密钥缓存时间
+	orderMinExpire    = 5 * time.Minute  // 统一下单订单失效时间的最短间隔
+	microPayMinExpire = 1 * time.Minute  // 付款码支付订单失效时间的最短间隔
+)
+
+var (
+	ErrSignVerifyFail      = errors.New("wx sign verify fail")         // 签名校验失败
+	ErrSandboxNotSupported = errors.New("wx not supported in sandbox") // 接口没有沙盒环境
 )
 
 //=================================================================
@@ -48,6 +68,8 @@ type ResponseReturnCode struct {
 type ResponseResultCode struct {
 	AppID      string `xml:"appid,emitempty"`
 	MchID      string `xml:"mch_id,emitempty"`
+	SubAppID   string `xml:"sub_appid,emitempty"`  // 【服务商】子商户公众账号ID
+	SubMchID   string `xml:"sub_mch_id,emitempty"` // 【服务商】子商户号
 	DeviceInfo string `xml:"device_info,emitempty"`
 	NonceStr   string `xml:"nonce_str,emitempty"`
 	Sign       string `xml:"sign,emitempty"`
@@ -60,6 +82,8 @@ type ResponseResultCode struct {
 type ResponseResultCodeSuccess struct {
 	OpenID         string `xml:"openid,emitempty"`           // 用户在商户appid下的唯一标识
 	IsSubscribe    string `xml:"is_subscribe,emitempty"`     // 是否关注公众号  Y/N
+	SubOpenID      string `xml:"sub_openid,emitempty"`       // 【服务商】用户在子商户appid下的唯一标识
+	SubIsSubscribe string `xml:"sub_is_subscribe,emitempty"` // 【服务商】是否关注子公众账号 Y/N
 	TradeType      string `xml:"trade_type,emitempty"`       // 调用接口提交的交易类型 APP
 	BankType       string `xml:"bank_type,emitempty"`        // 付款银行,采用字符串类型的银行标识
 	FeeType        string `xml:"fee_type,emitempty"`         // 货币种类 CNY
@@ -71,6 +95,19 @@ type ResponseResultCodeSuccess struct {
 	Attach         string `xml:"attach,emitempty"`           // 附加数据
 	TimeEnd        string `xml:"time_end,emitempty"`         // 支付完成时间
 	TradeStateDesc string `xml:"trade_state_desc,emitempty"` // 交易状态描述
+
+	SettlementTotalFee int64 `xml:"settlement_total_fee,emitempty"` // 应结订单金额，订单金额扣除免充值券金额，使用免充值券时返回
+	CouponFee          int64 `xml:"coupon_fee,emitempty"`           // 代金券金额
+	CouponCount        int64 `xml:"coupon_count,emitempty"`         // 代金券使用数量
+
+	Coupons []*WxCoupon `xml:"-"` // 代金券列表，由coupon_type_$n、coupon_id_$n、coupon_fee_$n解析
+}
+
+// WxCoupon 代金券
+type WxCoupon struct {
+	CouponType string // 代金券类型 coupon_type_$n CASH—充值代金券, NO_CASH—非充值优惠券
+	CouponID   string // 代金券ID coupon_id_$n
+	CouponFee  int64  // 单个代金券支付金额 coupon_fee_$n
 }
 
 type ResponseBaseCode struct {
@@ -78,6 +115,16 @@ type ResponseBaseCode struct {
 	ResponseResultCode
 }
 
+//=================================================================
+//							[Response]获取沙盒密钥
+//=================================================================
+type WxSandboxSignKeyResponse struct {
+	ResponseReturnCode
+
+	MchID          string `xml:"mch_id,emitempty"`          // 商户号
+	SandboxSignKey string `xml:"sandbox_signkey,emitempty"` // 沙盒密钥
+}
+
 //=================================================================
 //							[Response]统一下单
 //=================================================================
@@ -93,6 +140,24 @@ type WxUnifiedOrderResponse struct {
 	MWebURL string `xml:"mweb_url"` // 【H5支付返回】支付跳转链接 mweb_url为拉起微信支付收银台的中间页面，可通过访问该url来拉起微信客户端，完成支付,mweb_url的有效期为5分钟
 }
 
+//=================================================================
+//							[Response]付款码支付
+//=================================================================
+type WxMicroPayResponse struct {
+	ResponseBaseCode
+
+	ResponseResultCodeSuccess
+}
+
+//=================================================================
+//							[Response]撤销订单
+//=================================================================
+type WxReverseResponse struct {
+	ResponseBaseCode
+
+	Recall string `xml:"recall,emitempty"` // 是否需要继续调用撤销，Y-需要，N-不需要
+}
+
 //=================================================================
 //							[Response]查询订单
 //=================================================================
@@ -104,6 +169,13 @@ type WxOrderQueryResponse struct {
 	TradeState string `xml:"trade_state"` // 交易状态 SUCCESS—支付成功, REFUND—转入退款, NOTPAY—未支付,CLOSED—已关闭,REVOKED—已撤销（刷卡支付）,USERPAYING--用户支付中,PAYERROR--支付失败
 }
 
+//=================================================================
+//							[Response]关闭订单
+//=================================================================
+type WxCloseOrderResponse struct {
+	ResponseBaseCode
+}
+
 //=================================================================
 //							[Response]退款
 //=================================================================
@@ -133,4 +205,590 @@ type WxRefundQueryResponse struct {
 	RefundID0        string `xml:"refund_id_0"`                  // 微信退款单号
 	RefundFee0       int64  `xml:"refund_fee_0"`                 // 微信退款金额
 	RefundStatus0    string `xml:"refund_status_0"`              // 微信退款状态,SUCCESS—退款成功,REFUNDCLOSE—退款关闭,PROCESSING—退款处理中,CHANGE—退款异常
+
+	Refunds []*WxRefundQueryItem `xml:"-"` // 全部退款，由以_$n结尾的字段解析
+}
+
+// WxRefundQueryItem 退款查询中的单笔退款，对应以_$n结尾的字段
+type WxRefundQueryItem struct {
+	OutRefundNo         string            // 商户退款单号 out_refund_no_$n
+	RefundID            string            // 微信退款单号 refund_id_$n
+	RefundChannel       string            // 退款渠道 refund_channel_$n ORIGINAL—原路退款, BALANCE—退回到余额
+	RefundFee           int64             // 申请退款金额 refund_fee_$n
+	SettlementRefundFee int64             // 退款金额 settlement_refund_fee_$n
+	CouponRefundFee     int64             // 代金券退款总金额 coupon_refund_fee_$n
+	CouponRefundCount   int64             // 退款代金券使用数量 coupon_refund_count_$n
+	Coupons             []*WxRefundCoupon // 代金券退款明细 _$n_$m
+	RefundStatus        string            // 退款状态 refund_status_$n
+	RefundAccount       string            // 退款资金来源 refund_account_$n
+	RefundRecvAccout    string            // 退款入账账户 refund_recv_accout_$n
+	RefundSuccessTime   string            // 退款成功时间 refund_success_time_$n
+}
+
+// WxRefundCoupon 代金券退款，对应以_$n_$m结尾的字段
+type WxRefundCoupon struct {
+	CouponType      string // 代金券类型 coupon_type_$n_$m CASH—充值代金券, NO_CASH—非充值优惠券
+	CouponRefundID  string // 退款代金券ID coupon_refund_id_$n_$m
+	CouponRefundFee int64  // 单个退款代金券支付金额 coupon_refund_fee_$n_$m
+}
+
+//=================================================================
+//							[Notify]支付结果通知
+//=================================================================
+type WxPayNotify struct {
+	ResponseBaseCode
+
+	ResponseResultCodeSuccess
+
+	SignType   string `xml:"sign_type,emitempty"`   // 签名类型，目前支持HMAC-SHA256和MD5，默认为MD5
+	TradeState string `xml:"trade_state,emitempty"` // 交易状态，支付结果通知一般不返回，以result_code为准
+	ContractID string `xml:"contract_id,emitempty"` // 【委托代扣】委托代扣协议id
+
+	Status int64 `xml:"-"` // 支付状态，由result_code/trade_state映射, 4: 支付成功, 5: 支付失败
+}
+
+//=================================================================
+//							[Notify]退款结果通知
+//=================================================================
+type WxRefundNotify struct {
+	ResponseReturnCode
+
+	AppID    string `xml:"appid,emitempty"`
+	MchID    string `xml:"mch_id,emitempty"`
+	NonceStr string `xml:"nonce_str,emitempty"`
+	ReqInfo  string `xml:"req_info,emitempty"` // 加密信息，AES-256-ECB，密钥为商户API密钥的MD5
+}
+
+// WxRefundNotifyReqInfo 退款结果通知req_info解密后的内容
+type WxRefundNotifyReqInfo struct {
+	TransactionID       string `xml:"transaction_id"`        // 微信订单号
+	OutTradeNO          string `xml:"out_trade_no"`          // 商户订单号
+	RefundID            string `xml:"refund_id"`             // 微信退款单号
+	OutRefundNO         string `xml:"out_refund_no"`         // 商户退款单号
+	TotalFee            int64  `xml:"total_fee"`             // 订单金额
+	SettlementTotalFee  int64  `xml:"settlement_total_fee"`  // 应结订单金额
+	RefundFee           int64  `xml:"refund_fee"`            // 申请退款金额
+	SettlementRefundFee int64  `xml:"settlement_refund_fee"` // 退款金额=申请退款金额-非充值代金券退款金额
+	RefundStatus        string `xml:"refund_status"`         // 退款状态 SUCCESS-退款成功, CHANGE-退款异常, REFUNDCLOSE—退款关闭
+	SuccessTime         string `xml:"success_time"`          // 退款成功时间 2017-12-15 09:46:01
+	RefundRecvAccout    string `xml:"refund_recv_accout"`    // 退款入账账户
+	RefundAccount       string `xml:"refund_account"`        // 退款资金来源 REFUND_SOURCE_RECHARGE_FUNDS/REFUND_SOURCE_UNSETTLED_FUNDS
+	RefundRequestSource string `xml:"refund_request_source"` // 退款发起来源 API/VENDOR_PLATFORM
+}
+
+//=================================================================
+//							[Response]下载对账单
+//=================================================================
+// WxBillRecord 对账单明细，不同对账单类型包含的字段不同，没有的字段为空
+type WxBillRecord struct {
+	TradeTime          *time.Time // 交易时间
+	AppID              string     // 公众账号ID
+	MchID              string     // 商户号
+	SubMchID           string     // 特约商户号(子商户号)
+	DeviceInfo         string     // 设备号
+	TransactionID      string     // 微信订单号
+	OutTradeNO         string     // 商户订单号
+	OpenID             string     // 用户标识
+	TradeType          string     // 交易类型 JSAPI/NATIVE/APP/MWEB/MICROPAY
+	TradeState         string     // 交易状态 SUCCESS/REFUND/REVOKED
+	BankType           string     // 付款银行
+	FeeType            string     // 货币种类
+	SettlementTotalFee int64      // 应结订单金额，单位：分
+	CouponFee          int64      // 代金券金额，单位：分
+	RefundApplyTime    *time.Time // 退款申请时间【退款账单】
+	RefundSuccessTime  *time.Time // 退款成功时间【退款账单】
+	RefundID           string     // 微信退款单号
+	OutRefundNO        string     // 商户退款单号
+	RefundFee          int64      // 退款金额，单位：分
+	CouponRefundFee    int64      // 充值券退款金额，单位：分
+	RefundType         string     // 退款类型 ORIGINAL/BALANCE
+	RefundStatus       string     // 退款状态 SUCCESS/FAIL/PROCESSING
+	Body               string     // 商品名称
+	Attach             string     // 商户数据包
+	ServiceCharge      int64      // 手续费，单位：十万分之一元，如0.00600元为600
+	Rate               string     // 费率，如0.60%
+	TotalFee           int64      // 订单金额，单位：分
+	ApplyRefundFee     int64      // 申请退款金额，单位：分
+	RateNote           string     // 费率备注
+}
+
+// WxBillSummary 对账单汇总
+type WxBillSummary struct {
+	TradeCount         int64 // 总交易单数
+	SettlementTotalFee int64 // 应结订单总金额，单位：分
+	RefundFee          int64 // 退款总金额，单位：分
+	CouponRefundFee    int64 // 充值券退款总金额，单位：分
+	ServiceCharge      int64 // 手续费总金额，单位：十万分之一元
+	TotalFee           int64 // 订单总金额，单位：分
+	ApplyRefundFee     int64 // 申请退款总金额，单位：分
+}
+
+//=================================================================
+//							[Request]分账
+//=================================================================
+// ProfitSharingReceiver 分账接收方
+type ProfitSharingReceiver struct {
+	Type           string `json:"type"`                      // 分账接收方类型 MERCHANT_ID/PERSONAL_OPENID/PERSONAL_SUB_OPENID
+	Account        string `json:"account"`                   // 分账接收方帐号
+	Name           string `json:"name,omitempty"`            // 分账接收方全称，类型为MERCHANT_ID时必传
+	RelationType   string `json:"relation_type,omitempty"`   // 【添加接收方】与分账方的关系类型 SERVICE_PROVIDER/STORE/STAFF/STORE_OWNER/PARTNER/HEADQUARTER/BRAND/DISTRIBUTOR/USER/SUPPLIER/CUSTOM
+	CustomRelation string `json:"custom_relation,omitempty"` // 【添加接收方】自定义的分账关系，relation_type为CUSTOM时必传
+	Amount         int64  `json:"amount,omitempty"`          // 【请求分账】分账金额，单位为分
+	Description    string `json:"description,omitempty"`     // 【请求分账】分账描述
+	Result         string `json:"result,omitempty"`          // 【分账查询】分账结果 PENDING/SUCCESS/CLOSED
+	FinishTime     string `json:"finish_time,omitempty"`     // 【分账查询】分账完成时间
+	FailReason     string `json:"fail_reason,omitempty"`     // 【分账查询】分账失败原因
+}
+
+// ProfitSharingReceiverParam 添加/删除分账接收方
+type ProfitSharingReceiverParam struct {
+	SubMerchant // 【服务商】子商户
+
+	Receiver *ProfitSharingReceiver // 分账接收方
+}
+
+// ProfitSharingParam 请求单次分账/多次分账
+type ProfitSharingParam struct {
+	SubMerchant // 【服务商】子商户
+
+	TransactionID string                   // 微信订单号
+	OutOrderNO    string                   // 商户分账单号，同一分账单号多次请求等同一次
+	Receivers     []*ProfitSharingReceiver // 分账接收方列表，最多50个
+}
+
+// ProfitSharingQueryParam 查询分账结果
+type ProfitSharingQueryParam struct {
+	SubMerchant // 【服务商】子商户
+
+	TransactionID string // 微信订单号
+	OutOrderNO    string // 商户分账单号
+}
+
+// ProfitSharingFinishParam 完结分账
+type ProfitSharingFinishParam struct {
+	SubMerchant // 【服务商】子商户
+
+	TransactionID string // 微信订单号
+	OutOrderNO    string // 商户分账单号
+	Description   string // 分账完结描述
+}
+
+// ProfitSharingReturnParam 分账回退
+type ProfitSharingReturnParam struct {
+	SubMerchant // 【服务商】子商户
+
+	OrderID           string // 微信分账单号，与OutOrderNO二选一
+	OutOrderNO        string // 商户分账单号，与OrderID二选一
+	OutReturnNO       string // 商户回退单号，同一回退单号多次请求等同一次
+	ReturnAccountType string // 回退方类型，暂时只支持MERCHANT_ID
+	ReturnAccount     string // 回退方账号
+	ReturnAmount      int64  // 回退金额，单位为分
+	Description       string // 回退描述
+}
+
+// ProfitSharingReturnQueryParam 回退结果查询
+type ProfitSharingReturnQueryParam struct {
+	SubMerchant // 【服务商】子商户
+
+	OrderID     string // 微信分账单号，与OutOrderNO二选一
+	OutOrderNO  string // 商户分账单号，与OrderID二选一
+	OutReturnNO string // 商户回退单号
+}
+
+//=================================================================
+//							[Response]分账
+//=================================================================
+type WxProfitSharingReceiverResponse struct {
+	ResponseBaseCode
+
+	Receiver string `xml:"receiver"` // 分账接收方，JSON格式
+}
+
+type WxProfitSharingResponse struct {
+	ResponseBaseCode
+
+	TransactionID string `xml:"transaction_id"` // 微信订单号
+	OutOrderNO    string `xml:"out_order_no"`   // 商户分账单号
+	OrderID       string `xml:"order_id"`       // 微信分账单号
+}
+
+type WxProfitSharingQueryResponse struct {
+	ResponseBaseCode
+
+	TransactionID string `xml:"transaction_id"` // 微信订单号
+	OutOrderNO    string `xml:"out_order_no"`   // 商户分账单号
+	OrderID       string `xml:"order_id"`       // 微信分账单号
+	Status        string `xml:"status"`         // 分账单状态 ACCEPTED—受理成功, PROCESSING—处理中, FINISHED—处理完成, CLOSED—处理失败，已关单
+	CloseReason   string `xml:"close_reason"`   // 关单原因 NO_AUTH—分账授权已解除
+	Amount        int64  `xml:"amount"`         // 【完结分账】分账完结的分账金额，单位为分
+	Description   string `xml:"description"`    // 【完结分账】分账完结的原因描述
+	ReceiversJSON string `xml:"receivers"`      // 分账接收方列表，JSON格式
+
+	Receivers []*ProfitSharingReceiver `xml:"-"` // 分账接收方列表，由ReceiversJSON解析
+}
+
+type WxProfitSharingReturnResponse struct {
+	ResponseBaseCode
+
+	OrderID           string `xml:"order_id"`            // 微信分账单号
+	OutOrderNO        string `xml:"out_order_no"`        // 商户分账单号
+	OutReturnNO       string `xml:"out_return_no"`       // 商户回退单号
+	ReturnNO          string `xml:"return_no"`           // 微信回退单号
+	ReturnAccountType string `xml:"return_account_type"` // 回退方类型
+	ReturnAccount     string `xml:"return_account"`      // 回退方账号
+	ReturnAmount      int64  `xml:"return_amount"`       // 回退金额，单位为分
+	Description       string `xml:"description"`         // 回退描述
+	Result            string `xml:"result"`              // 回退结果 PROCESSING—处理中, SUCCESS—已成功, FAILED—已失败
+	FailReason        string `xml:"fail_reason"`         // 失败原因 ACCOUNT_ABNORMAL/TIME_OUT_CLOSED/PAYER_ACCOUNT_ABNORMAL
+	FinishTime        string `xml:"finish_time"`         // 完成时间
+}
+
+//=================================================================
+//							[Request]企业付款
+//=================================================================
+// TransferParam 付款到零钱
+type TransferParam struct {
+	PartnerTradeNO string // 商户订单号，同一单号重复请求视为同一笔付款
+	OpenID         string // 收款用户在AppID下的openid
+	ReUserName     string // 收款用户真实姓名，不为空时校验真实姓名
+	Amount         int64  // 付款金额，单位为分
+	Desc           string // 付款备注
+	ClientIP       string // 调用接口的机器IP地址
+	DeviceInfo     string // 设备号
+}
+
+// TransferBankParam 付款到银行卡
+type TransferBankParam struct {
+	PartnerTradeNO string // 商户付款单号，同一单号重复请求视为同一笔付款
+	BankNO         string // 收款方银行卡号，请求时使用RSA公钥加密
+	TrueName       string // 收款方用户名，请求时使用RSA公钥加密
+	BankCode       string // 收款方开户行，银行编号 https://pay.weixin.qq.com/wiki/doc/api/tools/mch_pay.php?chapter=24_4
+	Amount         int64  // 付款金额，单位为分
+	Desc           string // 付款说明
+}
+
+//=================================================================
+//							[Response]企业付款
+//=================================================================
+// ResponseTransferResultCode 企业付款、现金红包业务结果
+type ResponseTransferResultCode struct {
+	ResultCode string `xml:"result_code,emitempty"`
+	ErrCode    string `xml:"err_code,emitempty"`
+	ErrCodeDes string `xml:"err_code_des,emitempty"`
+}
+
+type WxTransferResponse struct {
+	ResponseReturnCode
+	ResponseTransferResultCode
+
+	MchAppID       string `xml:"mch_appid"`        // 商户appid
+	MchID          string `xml:"mchid"`            // 商户号
+	DeviceInfo     string `xml:"device_info"`      // 设备号
+	PartnerTradeNO string `xml:"partner_trade_no"` // 商户订单号
+	PaymentNO      string `xml:"payment_no"`       // 微信付款单号
+	PaymentTime    string `xml:"payment_time"`     // 付款成功时间
+}
+
+type WxTransferQueryResponse struct {
+	ResponseReturnCode
+	ResponseTransferResultCode
+
+	AppID          string `xml:"appid"`            // 商户appid
+	MchID          string `xml:"mch_id"`           // 商户号
+	PartnerTradeNO string `xml:"partner_trade_no"` // 商户订单号
+	DetailID       string `xml:"detail_id"`        // 微信付款单号
+	Status         string `xml:"status"`           // 转账状态 SUCCESS/FAILED/PROCESSING
+	Reason         string `xml:"reason"`           // 失败原因
+	OpenID         string `xml:"openid"`           // 收款用户openid
+	TransferName   string `xml:"transfer_name"`    // 收款用户姓名
+	PaymentAmount  int64  `xml:"payment_amount"`   // 付款金额，单位为分
+	TransferTime   string `xml:"transfer_time"`    // 发起转账的时间
+	PaymentTime    string `xml:"payment_time"`     // 付款成功时间
+	Desc           string `xml:"desc"`             // 付款备注
+}
+
+type WxTransferBankResponse struct {
+	ResponseReturnCode
+	ResponseTransferResultCode
+
+	MchID          string `xml:"mch_id"`           // 商户号
+	PartnerTradeNO string `xml:"partner_trade_no"` // 商户付款单号
+	Amount         int64  `xml:"amount"`           // 付款金额，单位为分
+	PaymentNO      string `xml:"payment_no"`       // 微信付款单号
+	CmmsAmt        int64  `xml:"cmms_amt"`         // 手续费金额，单位为分
+}
+
+type WxTransferBankQueryResponse struct {
+	ResponseReturnCode
+	ResponseTransferResultCode
+
+	MchID          string `xml:"mch_id"`           // 商户号
+	PartnerTradeNO string `xml:"partner_trade_no"` // 商户付款单号
+	PaymentNO      string `xml:"payment_no"`       // 微信付款单号
+	BankNOMd5      string `xml:"bank_no_md5"`      // 收款用户银行卡号的MD5
+	TrueNameMd5    string `xml:"true_name_md5"`    // 收款人真实姓名的MD5
+	Amount         int64  `xml:"amount"`           // 付款金额，单位为分
+	Status         string `xml:"status"`           // 付款状态 PROCESSING/SUCCESS/FAILED/BANK_FAIL
+	CmmsAmt        int64  `xml:"cmms_amt"`         // 手续费金额，单位为分
+	CreateTime     string `xml:"create_time"`      // 商户下单时间
+	PaySuccTime    string `xml:"pay_succ_time"`    // 成功付款时间
+	Reason         string `xml:"reason"`           // 失败原因
+}
+
+type WxGetPublicKeyResponse struct {
+	ResponseReturnCode
+	ResponseTransferResultCode
+
+	MchID  string `xml:"mch_id"`  // 商户号
+	PubKey string `xml:"pub_key"` // RSA公钥，PKCS#1格式
+}
+
+//=================================================================
+//							[Request]现金红包
+//=================================================================
+// RedPackParam 发放普通红包/裂变红包
+type RedPackParam struct {
+	MchBillNO   string // 商户订单号，同一单号重复请求视为同一个红包
+	SendName    string // 商户名称，红包发送者名称
+	ReOpenID    string // 接收红包的用户openid，裂变红包为种子用户
+	TotalAmount int64  // 付款金额，单位为分
+	TotalNum    int64  // 红包发放总人数，普通红包固定为1，裂变红包不小于3
+	Wishing     string // 红包祝福语
+	ClientIP    string // 【普通红包】调用接口的机器IP地址
+	ActName     string // 活动名称
+	Remark      string // 备注信息
+	SceneID     string // 场景id，发放红包金额小于1元或大于200元时必传 PRODUCT_1~PRODUCT_8
+	RiskInfo    string // 活动信息，urlencode后的posttime、mobile、deviceid、clientversion等
+}
+
+//=================================================================
+//							[Response]现金红包
+//=================================================================
+type WxRedPackResponse struct {
+	ResponseReturnCode
+	ResponseTransferResultCode
+
+	MchBillNO   string `xml:"mch_billno"`   // 商户订单号
+	MchID       string `xml:"mch_id"`       // 商户号
+	WxAppID     string `xml:"wxappid"`      // 公众账号appid
+	ReOpenID    string `xml:"re_openid"`    // 接收红包的用户openid
+	TotalAmount int64  `xml:"total_amount"` // 付款金额，单位为分
+	SendListID  string `xml:"send_listid"`  // 微信红包订单号
+}
+
+type WxRedPackInfoResponse struct {
+	ResponseReturnCode
+	ResponseTransferResultCode
+
+	MchBillNO    string             `xml:"mch_billno"`    // 商户订单号
+	MchID        string             `xml:"mch_id"`        // 商户号
+	DetailID     string             `xml:"detail_id"`     // 微信红包单号
+	Status       string             `xml:"status"`        // 红包状态 SENDING/SENT/FAILED/RECEIVED/RFUND_ING/REFUND
+	SendType     string             `xml:"send_type"`     // 发放类型 API/UPLOAD/ACTIVITY
+	HbType       string             `xml:"hb_type"`       // 红包类型 GROUP/NORMAL
+	TotalNum     int64              `xml:"total_num"`     // 红包个数
+	TotalAmount  int64              `xml:"total_amount"`  // 红包总金额，单位为分
+	Reason       string             `xml:"reason"`        // 发送失败原因
+	SendTime     string             `xml:"send_time"`     // 红包发送时间
+	RefundTime   string             `xml:"refund_time"`   // 红包退款时间
+	RefundAmount int64              `xml:"refund_amount"` // 红包退款金额，单位为分
+	Wishing      string             `xml:"wishing"`       // 祝福语
+	Remark       string             `xml:"remark"`        // 活动描述
+	ActName      string             `xml:"act_name"`      // 活动名称
+	Records      []*WxRedPackRecord `xml:"hblist>hbinfo"` // 领取红包的用户列表，裂变红包包含每个领取人的记录
+}
+
+// WxRedPackRecord 红包领取记录
+type WxRedPackRecord struct {
+	OpenID  string `xml:"openid"`   // 领取红包的用户openid
+	Amount  int64  `xml:"amount"`   // 领取金额，单位为分
+	RcvTime string `xml:"rcv_time"` // 领取红包的时间
+}
+
+//=================================================================
+//							[Request]委托代扣签约
+//=================================================================
+// PapayContractParam 签约参数
+type PapayContractParam struct {
+	PlanID                 string // 协议模板id，商户平台配置
+	ContractCode           string // 商户侧的签约协议号
+	RequestSerial          int64  // 商户请求签约时的序列号，要求唯一性
+	ContractDisplayAccount string // 签约用户的名称，用于页面展示
+	NotifyURL              string // 签约/解约结果通知地址
+	ClientIP               string // 【H5】用户客户端的真实IP
+	ReturnWeb              bool   // 【公众号】签约完成后是否返回商户页面
+	ReturnAppID            string // 【App/H5】签约完成后跳转回的应用appid
+}
+
+// PapayContractQueryParam 查询/解约参数，ContractID与PlanID+ContractCode二选一
+type PapayContractQueryParam struct {
+	ContractID                string // 委托代扣协议id
+	PlanID                    string // 协议模板id
+	ContractCode              string // 商户侧的签约协议号
+	ContractTerminationRemark string // 【解约】解约原因
+}
+
+//=================================================================
+//							[Response]委托代扣
+//=================================================================
+type WxPapayPreEntrustResponse struct {
+	ResponseBaseCode
+
+	PreEntrustWebID string `xml:"pre_entrustweb_id"` // 预签约ID，有效期2小时，App调起签约时使用
+}
+
+// WxPapayContract 签约协议，签约/解约通知、查询签约关系和解约共用
+type WxPapayContract struct {
+	ResponseBaseCode
+
+	ContractID                string `xml:"contract_id"`                 // 委托代扣协议id
+	PlanID                    string `xml:"plan_id"`                     // 协议模板id
+	ContractCode              string `xml:"contract_code"`               // 商户侧的签约协议号
+	RequestSerial             int64  `xml:"request_serial"`              // 签约时的请求序列号
+	OpenID                    string `xml:"openid"`                      // 用户标识
+	ChangeType                string `xml:"change_type"`                 // 【通知】变更类型 ADD—签约, DELETE—解约
+	OperateTime               string `xml:"operate_time"`                // 【通知】操作时间
+	ContractState             int64  `xml:"contract_state"`              // 【查询】协议状态 0—已签约, 1—未生效
+	ContractSignedTime        string `xml:"contract_signed_time"`        // 协议签署时间
+	ContractExpiredTime       string `xml:"contract_expired_time"`       // 协议到期时间
+	ContractTerminatedTime    string `xml:"contract_terminated_time"`    // 协议解约时间
+	ContractTerminationMode   int64  `xml:"contract_termination_mode"`   // 协议解约方式 0—未解约, 1—有效期过自动解约, 2—用户主动解约, 3—商户API解约, 4—商户平台解约, 5—注销
+	ContractTerminationRemark string `xml:"contract_termination_remark"` // 解约备注
+}
+
+type WxPapOrderQueryResponse struct {
+	WxOrderQueryResponse
+
+	ContractID string `xml:"contract_id"` // 委托代扣协议id
+}
+
+//=================================================================
+//							[Notify]扫码支付模式一回调
+//=================================================================
+type WxNativeNotify struct {
+	AppID       string `xml:"appid"`        // 公众账号ID
+	OpenID      string `xml:"openid"`       // 用户标识
+	MchID       string `xml:"mch_id"`       // 商户号
+	IsSubscribe string `xml:"is_subscribe"` // 是否关注公众账号 Y/N
+	NonceStr    string `xml:"nonce_str"`    // 随机字符串
+	ProductID   string `xml:"product_id"`   // 商品ID，生成二维码链接时传入的商品ID
+	Sign        string `xml:"sign"`         // 签名
+}
+
+//=================================================================
+//							[Request]海关报关
+//=================================================================
+// CustomsDeclareParam 订单附加信息提交
+type CustomsDeclareParam struct {
+	OrderID      string // 商户订单号
+	ThirdOrderID string // 微信支付订单号
+	Customs      string // 海关，如GUANGZHOU_ZS、HANGZHOU_ZS、NINGBO、ZHENGZHOU_BS、CHONGQING、XIAN、SHANGHAI_ZS、SHENZHEN、ZHENGZHOU_ZH、TIANJIN
+	MchCustomsNO string // 商户在海关登记的备案号
+	Duty         int64  // 关税，单位为分
+	ActionType   string // 报关类型 ADD/MODIFY，为空时为ADD
+	CertType     string // 证件类型，暂只支持身份证IDCARD，与CertID、Name同时传入时校验支付人身份
+	CertID       string // 证件号码
+	Name         string // 姓名
+
+	SubOrders []*CustomsSubOrder // 拆单报关的子订单，为空时不拆单
+}
+
+// CustomsSubOrder 拆单报关的子订单
+type CustomsSubOrder struct {
+	SubOrderNO   string // 商户子订单号
+	FeeType      string // 币种，为空时为CNY
+	OrderFee     int64  // 子订单应付金额，单位为分，需等于TransportFee与ProductFee之和
+	TransportFee int64  // 物流费，单位为分
+	ProductFee   int64  // 商品价格，单位为分
+}
+
+// CustomsQueryParam 订单附加信息查询，商户订单号、微信支付订单号、商户子订单号、微信子订单号四选一
+type CustomsQueryParam struct {
+	OrderID      string // 商户订单号
+	ThirdOrderID string // 微信支付订单号
+	SubOrderNO   string // 商户子订单号
+	SubOrderID   string // 微信子订单号
+	Customs      string // 海关
+}
+
+// CustomsRedeclareParam 订单附加信息重推，商户订单号与微信支付订单号二选一，子订单号二选一
+type CustomsRedeclareParam struct {
+	OrderID      string // 商户订单号
+	ThirdOrderID string // 微信支付订单号
+	SubOrderNO   string // 商户子订单号，拆单报关时必传
+	SubOrderID   string // 微信子订单号，拆单报关时必传
+	Customs      string // 海关
+	MchCustomsNO string // 商户在海关登记的备案号
+}
+
+//=================================================================
+//							[Response]海关报关
+//=================================================================
+type WxCustomsDeclareResponse struct {
+	ResponseBaseCode
+
+	State           string `xml:"state"`             // 报关状态 UNDECLARED/SUBMITTED/PROCESSING/SUCCESS/FAIL/EXCEPT
+	TransactionID   string `xml:"transaction_id"`    // 微信支付订单号
+	OutTradeNO      string `xml:"out_trade_no"`      // 商户订单号
+	SubOrderNO      string `xml:"sub_order_no"`      // 商户子订单号
+	SubOrderID      string `xml:"sub_order_id"`      // 微信子订单号
+	ModifyTime      string `xml:"modify_time"`       // 最后更新时间
+	CertCheckResult string `xml:"cert_check_result"` // 订购人和支付人身份信息校验结果 UNCHECKED/SAME/DIFFERENT
+}
+
+type WxCustomsDeclareQueryResponse struct {
+	ResponseBaseCode
+
+	TransactionID string `xml:"transaction_id"` // 微信支付订单号
+	Count         int64  `xml:"count"`          // 笔数
+
+	SubOrders []*WxCustomsSubOrderState `xml:"-"` // 子订单报关状态，由以_$n结尾的字段解析
+}
+
+// WxCustomsSubOrderState 子订单报关状态
+type WxCustomsSubOrderState struct {
+	SubOrderNO      string // 商户子订单号 sub_order_no_$n
+	SubOrderID      string // 微信子订单号 sub_order_id_$n
+	MchCustomsNO    string // 商户海关备案号 mch_customs_no_$n
+	Customs         string // 海关 customs_$n
+	CertCheckResult string // 身份信息校验结果 cert_check_result_$n
+	FeeType         string // 币种 fee_type_$n
+	OrderFee        int64  // 应付金额 order_fee_$n
+	Duty            int64  // 关税 duty_$n
+	TransportFee    int64  // 物流费 transport_fee_$n
+	ProductFee      int64  // 商品价格 product_fee_$n
+	State           string // 报关状态 state_$n
+	Explanation     string // 申报结果说明 explanation_$n
+	ModifyTime      string // 最后更新时间 modify_time_$n
+}
+
+type WxCustomsRedeclareResponse struct {
+	ResponseBaseCode
+
+	TransactionID string `xml:"transaction_id"` // 微信支付订单号
+	OutTradeNO    string `xml:"out_trade_no"`   // 商户订单号
+	SubOrderNO    string `xml:"sub_order_no"`   // 商户子订单号
+	SubOrderID    string `xml:"sub_order_id"`   // 微信子订单号
+	State         string `xml:"state"`          // 报关状态
+	Explanation   string `xml:"explanation"`    // 申报结果说明
+	ModifyTime    string `xml:"modify_time"`    // 最后更新时间
+}
+
+//=================================================================
+//							[Response]转换短链接
+//=================================================================
+type WxShortURLResponse struct {
+	ResponseBaseCode
+
+	ShortURL string `xml:"short_url"` // 转换后的URL
+}
+
+//=================================================================
+//							[Response]付款码查询openid
+//=================================================================
+type WxAuthCodeToOpenIDResponse struct {
+	ResponseBaseCode
+
+	OpenID    string `xml:"openid"`     // 用户在商户appid下的唯一标识
+	SubOpenID string `xml:"sub_openid"` // 【服务商】用户在子商户appid下的唯一标识
 }
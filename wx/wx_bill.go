@@ -0,0 +1,258 @@
+package wx
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DownloadBill 下载对账单 https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_6&index=8
+// billDate格式为20140603，billType为BillTypeAll/BillTypeSuccess/BillTypeRefund，useGzip为true时以GZIP压缩传输，
+// subMerchant为空时使用WxClient上配置的子商户。
+// 对账单按行读取，使用完毕后需要调用Close：
+//
+//	bill, err := client.DownloadBill("20140603", BillTypeAll, true, SubMerchant{})
+//	defer bill.Close()
+//	for bill.Next() {
+//		record := bill.Record()
+//	}
+//	err = bill.Err()
+//	summary := bill.Summary()
+func (client *WxClient) DownloadBill(billDate string, billType string, useGzip bool, subMerchant SubMerchant) (*WxBillIterator, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxDownloadBillUrl
+	} else {
+		requestUrl = DownloadBillUrl
+	}
+
+	params := make(map[string]string)
+	params["bill_date"] = billDate // 【必传】下载对账单的日期，格式：20140603
+	params["bill_type"] = billType // 【必传】账单类型 ALL/SUCCESS/REFUND
+	if useGzip {
+		params["tar_type"] = "GZIP" // 【非必传】压缩账单，非必传参数，固定值：GZIP，返回格式为.gzip的压缩包账单
+	}
+	_, err := client.appendSubMerchantParams(params, subMerchant)
+	if err != nil {
+		return nil, err
+	}
+	params = client.appendBasicParams(params)
+
+	resp, err := client.post(false, requestUrl, params)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := newWxBillIterator(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return iterator, nil
+}
+
+// WxBillIterator 对账单迭代器，逐行解析对账单，避免整份对账单加载到内存
+type WxBillIterator struct {
+	body    io.ReadCloser
+	gzip    *gzip.Reader
+	reader  *csv.Reader
+	columns map[string]int
+	record  *WxBillRecord
+	summary *WxBillSummary
+	err     error
+}
+
+func newWxBillIterator(body io.ReadCloser) (*WxBillIterator, error) {
+	iterator := &WxBillIterator{body: body}
+
+	var reader io.Reader
+	bufReader := bufio.NewReader(body)
+	head, _ := bufReader.Peek(5)
+	if bytes.HasPrefix(head, []byte{0x1f, 0x8b}) { // gzip压缩账单
+		gzipReader, err := gzip.NewReader(bufReader)
+		if err != nil {
+			return nil, err
+		}
+		iterator.gzip = gzipReader
+		reader = gzipReader
+	} else if bytes.Equal(head, []byte("<xml>")) { // 下载失败时返回XML
+		var respObject ResponseReturnCode
+		err := xml.NewDecoder(bufReader).Decode(&respObject)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New(respObject.ReturnMsg)
+	} else {
+		reader = bufReader
+	}
+
+	iterator.reader = csv.NewReader(reader)
+	iterator.reader.FieldsPerRecord = -1
+	iterator.reader.LazyQuotes = true
+
+	// 第一行为表头
+	header, err := iterator.reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("bill is empty")
+		}
+		return nil, err
+	}
+	iterator.columns = make(map[string]int)
+	for i, name := range header {
+		iterator.columns[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	return iterator, nil
+}
+
+// Next 读取下一条明细，没有更多明细或出错时返回false
+func (iterator *WxBillIterator) Next() bool {
+	if iterator.err != nil || iterator.summary != nil {
+		return false
+	}
+
+	fields, err := iterator.reader.Read()
+	if err != nil {
+		if err != io.EOF {
+			iterator.err = err
+		}
+		return false
+	}
+
+	// 明细之后为汇总表头及汇总数据
+	if strings.HasPrefix(strings.TrimSpace(fields[0]), "总") {
+		values, err := iterator.reader.Read()
+		if err != nil {
+			iterator.err = err
+			return false
+		}
+		iterator.summary = parseBillSummary(fields, values)
+		return false
+	}
+
+	iterator.record = iterator.parseRecord(fields)
+	return true
+}
+
+// Record 当前明细
+func (iterator *WxBillIterator) Record() *WxBillRecord {
+	return iterator.record
+}
+
+// Summary 对账单汇总，读取完所有明细后可用
+func (iterator *WxBillIterator) Summary() *WxBillSummary {
+	return iterator.summary
+}
+
+// Err 读取过程中出现的错误
+func (iterator *WxBillIterator) Err() error {
+	return iterator.err
+}
+
+// Close 关闭对账单
+func (iterator *WxBillIterator) Close() error {
+	if iterator.gzip != nil {
+		iterator.gzip.Close()
+	}
+	return iterator.body.Close()
+}
+
+func (iterator *WxBillIterator) parseRecord(fields []string) *WxBillRecord {
+	value := func(names ...string) string {
+		for _, name := range names {
+			if index, ok := iterator.columns[name]; ok && index < len(fields) {
+				return trimBillField(fields[index])
+			}
+		}
+		return ""
+	}
+
+	record := &WxBillRecord{
+		AppID:              value("公众账号ID"),
+		MchID:              value("商户号"),
+		SubMchID:           value("特约商户号", "子商户号"),
+		DeviceInfo:         value("设备号"),
+		TransactionID:      value("微信订单号"),
+		OutTradeNO:         value("商户订单号"),
+		OpenID:             value("用户标识"),
+		TradeType:          value("交易类型"),
+		TradeState:         value("交易状态"),
+		BankType:           value("付款银行"),
+		FeeType:            value("货币种类"),
+		SettlementTotalFee: YuanToFen(value("应结订单金额", "总金额")),
+		CouponFee:          YuanToFen(value("代金券金额", "代金券或立减优惠金额")),
+		RefundID:           value("微信退款单号"),
+		OutRefundNO:        value("商户退款单号"),
+		RefundFee:          YuanToFen(value("退款金额")),
+		CouponRefundFee:    YuanToFen(value("充值券退款金额", "代金券或立减优惠退款金额")),
+		RefundType:         value("退款类型"),
+		RefundStatus:       value("退款状态"),
+		Body:               value("商品名称"),
+		Attach:             value("商户数据包"),
+		ServiceCharge:      parseServiceCharge(value("手续费")),
+		Rate:               value("费率"),
+		TotalFee:           YuanToFen(value("订单金额")),
+		ApplyRefundFee:     YuanToFen(value("申请退款金额")),
+		RateNote:           value("费率备注"),
+	}
+	if tradeTime := value("交易时间"); IsNotEmpty(tradeTime) {
+		record.TradeTime = GetDateFullTime(tradeTime)
+	}
+	if applyTime := value("退款申请时间"); IsNotEmpty(applyTime) {
+		record.RefundApplyTime = GetDateFullTime(applyTime)
+	}
+	if successTime := value("退款成功时间"); IsNotEmpty(successTime) {
+		record.RefundSuccessTime = GetDateFullTime(successTime)
+	}
+	return record
+}
+
+func parseBillSummary(header []string, fields []string) *WxBillSummary {
+	columns := make(map[string]string)
+	for i, name := range header {
+		if i < len(fields) {
+			columns[strings.TrimSpace(name)] = trimBillField(fields[i])
+		}
+	}
+	value := func(names ...string) string {
+		for _, name := range names {
+			if v, ok := columns[name]; ok {
+				return v
+			}
+		}
+		return ""
+	}
+
+	tradeCount, _ := strconv.ParseInt(value("总交易单数"), 10, 64)
+	return &WxBillSummary{
+		TradeCount:         tradeCount,
+		SettlementTotalFee: YuanToFen(value("应结订单总金额", "总交易额")),
+		RefundFee:          YuanToFen(value("退款总金额", "总退款金额")),
+		CouponRefundFee:    YuanToFen(value("充值券退款总金额", "总代金券或立减优惠退款金额")),
+		ServiceCharge:      parseServiceCharge(value("手续费总金额")),
+		TotalFee:           YuanToFen(value("订单总金额")),
+		ApplyRefundFee:     YuanToFen(value("申请退款总金额")),
+	}
+}
+
+// 手续费保留5位小数，如0.00600，按十万分之一元转换，避免小额交易的手续费按分取整后丢失
+func parseServiceCharge(value string) int64 {
+	charge, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(charge * 100000))
+}
+
+// 对账单数据以`开头，防止数字被Excel转换
+func trimBillField(field string) string {
+	return strings.TrimPrefix(strings.TrimSpace(field), "`")
+}
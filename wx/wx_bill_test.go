@@ -0,0 +1,102 @@
+package wx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+)
+
+const testBill = "\ufeff交易时间,公众账号ID,商户号,特约商户号,设备号,微信订单号,商户订单号,用户标识,交易类型,交易状态,付款银行,货币种类,应结订单金额,代金券金额,微信退款单号,商户退款单号,退款金额,充值券退款金额,退款类型,退款状态,商品名称,商户数据包,手续费,费率,订单金额,申请退款金额,费率备注\r\n" +
+	"`2020-10-17 12:30:45,`wx2421b1c4370ec43b,`10000100,`0,`,`4200000318201905270000123456,`T20201017001,`oUpF8uMuAJO_M2pxb1Q9zNjWeS6o,`NATIVE,`SUCCESS,`CMC,`CNY,`2.00,`0.00,`0,`0,`0.00,`0.00,`,`,`测试商品,`,`0.01200,`0.60%,`2.00,`0.00,`\r\n" +
+	"`2020-10-17 13:00:00,`wx2421b1c4370ec43b,`10000100,`0,`,`4200000318201905270000123457,`T20201017002,`oUpF8uMuAJO_M2pxb1Q9zNjWeS6o,`JSAPI,`REFUND,`CMC,`CNY,`1.50,`0.00,`50000000382019052709732678859,`R20201017002,`1.50,`0.00,`ORIGINAL,`SUCCESS,`测试商品,`,`-0.00600,`0.60%,`1.50,`1.50,`\r\n" +
+	"`2020-10-17 14:00:00,`wx2421b1c4370ec43b,`10000100,`0,`,`4200000318201905270000123458,`T20201017003,`oUpF8uMuAJO_M2pxb1Q9zNjWeS6o,`MICROPAY,`SUCCESS,`CMC,`CNY,`0.01,`0.00,`0,`0,`0.00,`0.00,`,`,`测试商品,`,`0.00006,`0.60%,`0.01,`0.00,`\r\n" +
+	"总交易单数,应结订单总金额,退款总金额,充值券退款总金额,手续费总金额,订单总金额,申请退款总金额\r\n" +
+	"`3,`3.51,`1.50,`0.00,`0.00606,`3.51,`1.50\r\n"
+
+func gzipBytes(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWxBillIterator(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"plain", []byte(testBill)},
+		{"gzip", gzipBytes(t, testBill)},
+	}
+	for _, tt := range tests {
+		iterator, err := newWxBillIterator(ioutil.NopCloser(bytes.NewReader(tt.body)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var records []*WxBillRecord
+		for iterator.Next() {
+			records = append(records, iterator.Record())
+		}
+		if err := iterator.Err(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := iterator.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if len(records) != 3 {
+			t.Fatalf("%s: got %d records, want 3", tt.name, len(records))
+		}
+		first := records[0]
+		if first.AppID != "wx2421b1c4370ec43b" || first.OutTradeNO != "T20201017001" || first.TradeState != "SUCCESS" ||
+			first.SettlementTotalFee != 200 || first.TotalFee != 200 || first.ServiceCharge != 1200 ||
+			first.TradeTime.Format("2006-01-02 15:04:05") != "2020-10-17 12:30:45" {
+			t.Errorf("%s: unexpected first record: %+v", tt.name, first)
+		}
+		second := records[1]
+		if second.RefundID != "50000000382019052709732678859" || second.RefundFee != 150 || second.RefundStatus != "SUCCESS" {
+			t.Errorf("%s: unexpected second record: %+v", tt.name, second)
+		}
+
+		// 小额交易的手续费不足1分，按十万分之一元保留
+		if third := records[2]; third.SettlementTotalFee != 1 || third.ServiceCharge != 6 {
+			t.Errorf("%s: unexpected third record: %+v", tt.name, third)
+		}
+
+		summary := iterator.Summary()
+		if summary == nil || summary.TradeCount != 3 || summary.SettlementTotalFee != 351 || summary.RefundFee != 150 || summary.ApplyRefundFee != 150 {
+			t.Fatalf("%s: unexpected summary: %+v", tt.name, summary)
+		}
+		var serviceCharge int64
+		for _, record := range records {
+			serviceCharge += record.ServiceCharge
+		}
+		if serviceCharge != summary.ServiceCharge {
+			t.Errorf("%s: service charge sum = %d, want %d", tt.name, serviceCharge, summary.ServiceCharge)
+		}
+	}
+}
+
+func TestWxBillIteratorError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"xml", "<xml><return_code><![CDATA[FAIL]]></return_code><return_msg><![CDATA[No Bill Exist]]></return_msg></xml>", "No Bill Exist"},
+		{"empty", "", "bill is empty"},
+	}
+	for _, tt := range tests {
+		_, err := newWxBillIterator(ioutil.NopCloser(bytes.NewReader([]byte(tt.body))))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
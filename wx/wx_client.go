@@ -3,6 +3,7 @@ package wx
 import (
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/hex"
@@ -15,6 +16,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -35,6 +37,20 @@ type WxClient struct {
 	ApiCertData []byte // API证书，微信支付接口中，涉及资金回滚的接口会使用到API证书，包括退款、撤销接口
 	IsSandbox   bool   // 是否为沙盒环境
 	SignType    string // 签名类型，目前支持HMAC-SHA256和MD5，默认为MD5
+	SubAppID    string // 【服务商】子商户公众账号ID，请求中未指定子商户时使用
+	SubMchID    string // 【服务商】子商户号，请求中未指定子商户时使用
+
+	MicroPayPolling       *MicroPayPolling // 付款码支付轮询配置，为空时使用DefaultMicroPayPolling
+	SkipResponseSignCheck bool             // 不校验响应签名，仅用于兼容不返回签名的旧沙箱环境
+	ReportLevel           int              // 交易保障上报级别，默认只上报付款码支付流程中的下单、查询和撤销
+	ServerIP              string           // 调用接口的机器IP，交易保障上报使用，为空时使用请求中的终端IP或本机IP
+
+	mu                     sync.Mutex
+	sandboxSignKey         string    // 沙盒密钥，沙盒环境使用该密钥签名
+	sandboxSignKeyExpireAt time.Time // 沙盒密钥过期时间
+
+	bankPublicKeyMu sync.Mutex
+	bankPublicKey   *rsa.PublicKey // 付款到银行卡使用的RSA公钥，用于加密收款方银行卡号和姓名
 }
 
 func AddWxClient(key string, client *WxClient) {
@@ -51,6 +67,13 @@ func GetWxClient(key string) *WxClient {
 
 // Order 统一下单
 func (client *WxClient) Order(chargeParam *ChargeParam) (*ChargeObject, error) {
+	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxMicro) {
+		return client.MicroPay(chargeParam)
+	}
+	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxPap) {
+		return client.PapPayApply(chargeParam)
+	}
+
 	var requestUrl string
 	if client.IsSandbox {
 		requestUrl = SandboxUnifiedOrderUrl
@@ -65,12 +88,33 @@ func (client *WxClient) Order(chargeParam *ChargeParam) (*ChargeObject, error) {
 	params["body"] = chargeParam.Description                          // 【必传】商品描述 APP: 需传入应用市场上的APP名字-实际商品名称，天天爱消除-游戏充值
 	params["spbill_create_ip"] = chargeParam.ClientIP                 // 【必传】用户端实际ip
 	params["notify_url"] = chargeParam.CallbackURL                    // 【必传】接收微信支付异步通知回调地址
+	if chargeParam.ProfitSharing {
+		params["profit_sharing"] = "Y" // 【非必传】是否需要分账 Y-是，需要分账 N-否，不分账
+	}
+	err := appendChargeOptions(params, chargeParam, orderMinExpire)
+	if err != nil {
+		return nil, err
+	}
 
 	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxH5) {
 		params["scene_info"] = chargeParam.SceneInfo // 【H5必传】场景信息, iOS移动应用, Android移动应用, WAP网站应用
 	}
+	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxNative) && IsNotEmpty(chargeParam.ProductID) {
+		params["product_id"] = chargeParam.ProductID // 【NATIVE必传】商品ID
+	}
 	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxJsapi) {
-		params["openid"] = chargeParam.OpenID // 【JSAPI必传】OpenID
+		if IsNotEmpty(chargeParam.SubOpenID) {
+			params["sub_openid"] = chargeParam.SubOpenID // 【服务商JSAPI】用户在子商户sub_appid下的openid
+		} else {
+			params["openid"] = chargeParam.OpenID // 【JSAPI必传】OpenID
+			if IsEmpty(chargeParam.OpenID) {
+				params["openid"] = chargeParam.PayerID
+			}
+		}
+	}
+	subMerchant, err := client.appendSubMerchantParams(params, chargeParam.SubMerchant)
+	if err != nil {
+		return nil, err
 	}
 	params = client.appendBasicParams(params)
 
@@ -87,6 +131,10 @@ func (client *WxClient) Order(chargeParam *ChargeParam) (*ChargeObject, error) {
 	if respObject.ReturnCode != "SUCCESS" { // 通信失败
 		return nil, errors.New(respObject.ReturnMsg)
 	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
 	if respObject.ResultCode != "SUCCESS" { // 支付失败
 		return nil, errors.New(respObject.ErrCodeDes)
 	}
@@ -105,8 +153,12 @@ func (client *WxClient) Order(chargeParam *ChargeParam) (*ChargeObject, error) {
 
 	wxPayParam := make(map[string]string)
 	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxJsapi) {
+		appID := client.AppID
+		if IsNotEmpty(chargeParam.SubOpenID) { // 使用sub_openid下单时，使用子商户sub_appid调起支付
+			appID = subMerchant.SubAppID
+		}
 		wxPayParam = map[string]string{
-			"appId":     client.AppID,
+			"appId":     appID,
 			"timeStamp": strconv.FormatInt(time.Now().Unix(), 10),
 			"nonceStr":  NonceStr(),
 			"package":   fmt.Sprintf("prepay_id=%s", respObject.PrepayID),
@@ -114,9 +166,13 @@ func (client *WxClient) Order(chargeParam *ChargeParam) (*ChargeObject, error) {
 		}
 		wxPayParam["paySign"] = client.sign(wxPayParam)
 	} else if strings.EqualFold(chargeParam.PayChannel, PayChannelWxApp) {
+		appID, partnerID := client.AppID, client.MchID
+		if IsNotEmpty(subMerchant.SubAppID) { // 服务商模式，使用子商户的移动应用调起支付
+			appID, partnerID = subMerchant.SubAppID, subMerchant.SubMchID
+		}
 		wxPayParam = map[string]string{
-			"appid":     client.AppID,
-			"partnerid": client.MchID,
+			"appid":     appID,
+			"partnerid": partnerID,
 			"prepayid":  respObject.PrepayID,
 			"package":   "Sign=WXPay",
 			"noncestr":  NonceStr(),
@@ -133,6 +189,10 @@ func (client *WxClient) Order(chargeParam *ChargeParam) (*ChargeObject, error) {
 
 // OrderQuery 订单查询
 func (client *WxClient) OrderQuery(orderQueryParam *OrderQueryParam) (*OrderQueryObject, error) {
+	if strings.EqualFold(orderQueryParam.PayChannel, PayChannelWxPap) {
+		return client.PapOrderQuery(orderQueryParam)
+	}
+
 	var requestUrl string
 	if client.IsSandbox {
 		requestUrl = SandboxOrderQueryUrl
@@ -142,9 +202,15 @@ func (client *WxClient) OrderQuery(orderQueryParam *OrderQueryParam) (*OrderQuer
 
 	params := make(map[string]string)
 	params["out_trade_no"] = orderQueryParam.OrderID // 【必传】商户系统内部订单号，要求32个字符内，只能是数字、大小写字母_-|*且在同一个商户号下唯一
+	_, err := client.appendSubMerchantParams(params, orderQueryParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
 	params = client.appendBasicParams(params)
 
-	xmlStr, err := client.postWithXml(false, requestUrl, params)
+	// 付款码支付轮询查询订单时也需要上报
+	microPay := strings.EqualFold(orderQueryParam.PayChannel, PayChannelWxMicro)
+	xmlStr, err := client.postWithXmlAndReport(false, requestUrl, params, client.needReport(requestUrl, microPay))
 	if err != nil {
 		return nil, err
 	}
@@ -157,9 +223,18 @@ func (client *WxClient) OrderQuery(orderQueryParam *OrderQueryParam) (*OrderQuer
 	if respObject.ReturnCode != "SUCCESS" { // 通信失败
 		return nil, errors.New(respObject.ReturnMsg)
 	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
 	if respObject.ResultCode != "SUCCESS" { // 支付失败
 		return nil, errors.New(respObject.ErrCodeDes)
 	}
+	params, err = XmlToMap(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	respObject.Coupons = parseCoupons(params, respObject.CouponCount)
 
 	// OrderQueryObject
 	object := &OrderQueryObject{
@@ -168,8 +243,57 @@ func (client *WxClient) OrderQuery(orderQueryParam *OrderQueryParam) (*OrderQuer
 		PayTime:         GetWxPayTime(respObject.TimeEnd),
 		ThirdOrderID:    respObject.TransactionID,
 		ThirdOrderFee:   respObject.TotalFee,
+		Attach:          respObject.Attach,
 		OrderQueryParam: orderQueryParam,
 	}
+	fillOrderQueryFees(object, &respObject.ResponseResultCodeSuccess)
+	return object, nil
+}
+
+// CloseOrder 关闭订单 https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_3&index=5
+func (client *WxClient) CloseOrder(closeOrderParam *CloseOrderParam) (*CloseOrderObject, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxCloseOrderUrl
+	} else {
+		requestUrl = CloseOrderUrl
+	}
+
+	params := make(map[string]string)
+	params["out_trade_no"] = closeOrderParam.OrderID // 【必传】商户系统内部订单号
+	_, err := client.appendSubMerchantParams(params, closeOrderParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+	params = client.appendBasicParams(params)
+
+	xmlStr, err := client.postWithXml(false, requestUrl, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxCloseOrderResponse
+	err = xml.Unmarshal([]byte(xmlStr), &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ReturnCode != "SUCCESS" { // 通信失败
+		return nil, errors.New(respObject.ReturnMsg)
+	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != "SUCCESS" && respObject.ErrCode != "ORDERCLOSED" { // 关闭失败，订单已关闭视为成功
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+
+	// CloseOrderObject
+	object := &CloseOrderObject{
+		OrderID:         closeOrderParam.OrderID,
+		Status:          OrderClosed,
+		CloseOrderParam: closeOrderParam,
+	}
 	return object, nil
 }
 
@@ -189,6 +313,10 @@ func (client *WxClient) Refund(refundParam *RefundParam) (*RefundObject, error)
 	params["refund_fee"] = strconv.FormatInt(refundParam.RefundFee, 10) // 【必传】退款金额, 单位：分
 	params["refund_desc"] = refundParam.RefundDesc                      // 【必传】退款描述
 	params["notify_url"] = refundParam.CallbackURL                      // 【非必传】回调地址，如果不传使用微信商户后台的url
+	_, err := client.appendSubMerchantParams(params, refundParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
 	params = client.appendBasicParams(params)
 
 	// 微信支付接口中，涉及资金回滚的接口会使用到API证书，包括退款、撤销接口。
@@ -205,6 +333,10 @@ func (client *WxClient) Refund(refundParam *RefundParam) (*RefundObject, error)
 	if respObject.ReturnCode != "SUCCESS" { // 通信失败
 		return nil, errors.New(respObject.ReturnMsg)
 	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
 	if respObject.ResultCode != "SUCCESS" { // 支付失败
 		return nil, errors.New(respObject.ErrCodeDes)
 	}
@@ -232,8 +364,27 @@ func (client *WxClient) RefundQuery(refundQueryParam *RefundQueryParam) (*Refund
 		requestUrl = RefundQueryUrl
 	}
 
+	// 四选一，同时存在优先级为：refund_id > out_refund_no > transaction_id > out_trade_no
 	params := make(map[string]string)
-	params["out_refund_no"] = refundQueryParam.RefundID // 【必传】商户系统内部的退款单号，商户系统内部唯一，只能是数字、大小写字母_-|*@ ，同一退款单号多次请求只退一笔。
+	if IsNotEmpty(refundQueryParam.ThirdRefundID) {
+		params["refund_id"] = refundQueryParam.ThirdRefundID // 微信退款单号
+	}
+	if IsNotEmpty(refundQueryParam.RefundID) {
+		params["out_refund_no"] = refundQueryParam.RefundID // 商户系统内部的退款单号，商户系统内部唯一，只能是数字、大小写字母_-|*@ ，同一退款单号多次请求只退一笔。
+	}
+	if IsNotEmpty(refundQueryParam.ThirdOrderID) {
+		params["transaction_id"] = refundQueryParam.ThirdOrderID // 微信订单号
+	}
+	if IsNotEmpty(refundQueryParam.OrderID) {
+		params["out_trade_no"] = refundQueryParam.OrderID // 商户系统内部订单号
+	}
+	if refundQueryParam.Offset > 0 {
+		params["offset"] = strconv.FormatInt(refundQueryParam.Offset, 10) // 【非必传】偏移量，当部分退款次数超过10次时可使用，表示返回的查询结果从这个偏移量开始取记录
+	}
+	_, err := client.appendSubMerchantParams(params, refundQueryParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
 	params = client.appendBasicParams(params)
 
 	xmlStr, err := client.postWithXml(false, requestUrl, params)
@@ -249,34 +400,56 @@ func (client *WxClient) RefundQuery(refundQueryParam *RefundQueryParam) (*Refund
 	if respObject.ReturnCode != "SUCCESS" { // 通信失败
 		return nil, errors.New(respObject.ReturnMsg)
 	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
 	if respObject.ResultCode != "SUCCESS" { // 支付失败
 		return nil, errors.New(respObject.ErrCodeDes)
 	}
-
-	var orderRefundStatus = OrderRefunding
-	if respObject.RefundStatus0 == "SUCCESS" {
-		orderRefundStatus = OrderRefundSuccess
-	} else if respObject.RefundStatus0 == "PROCESSING" {
-		orderRefundStatus = OrderRefunding
-	} else if respObject.RefundStatus0 == "CHANGE" {
-		orderRefundStatus = OrderRefundFail
-	} else if respObject.RefundStatus0 == "REFUNDCLOSE" {
-		orderRefundStatus = OrderRefundFail
-	} else {
-		// nothing
+	respParams, err := XmlToMap(xmlStr)
+	if err != nil {
+		return nil, err
 	}
+	respObject.Refunds = parseRefundQueryItems(respParams, respObject.RefundCount)
 
 	// RefundQueryObject
 	object := &RefundQueryObject{
 		OrderID:          respObject.OutTradeNO,
 		RefundID:         respObject.OutRefundNo0,
-		Status:           int64(orderRefundStatus),
+		Status:           OrderRefunding,
 		ThirdOrderID:     respObject.TransactionID,
 		ThirdOrderFee:    respObject.TotalFee,
 		ThirdRefundID:    respObject.RefundID0,
 		ThirdRefundFee:   respObject.RefundFee0,
+		TotalRefundCount: respObject.TotalRefundCount,
 		RefundQueryParam: refundQueryParam,
 	}
+	for _, item := range respObject.Refunds {
+		object.Refunds = append(object.Refunds, toRefundQueryItem(item))
+	}
+
+	// 按退款单号查询时返回对应的退款，否则返回第一笔退款
+	var current *RefundQueryItem
+	for _, item := range object.Refunds {
+		if (IsNotEmpty(refundQueryParam.ThirdRefundID) && item.ThirdRefundID == refundQueryParam.ThirdRefundID) ||
+			(IsNotEmpty(refundQueryParam.RefundID) && item.RefundID == refundQueryParam.RefundID) {
+			current = item
+			break
+		}
+	}
+	if current == nil && len(object.Refunds) > 0 {
+		current = object.Refunds[0]
+	}
+	if current != nil {
+		object.RefundID = current.RefundID
+		object.Status = current.Status
+		object.ThirdRefundID = current.ThirdRefundID
+		object.ThirdRefundFee = current.ThirdRefundFee
+		object.SettlementRefundFee = current.SettlementRefundFee
+		object.RefundTime = current.RefundTime
+		object.RefundRecvAccount = current.RefundRecvAccount
+	}
 	return object, nil
 }
 
@@ -290,24 +463,261 @@ var mapTradeStateToStatus = map[string]int64{
 	"SUCCESS":    OrderPaidSuccess, // 4: 支付成功
 	"PAYERROR":   OrderPaidFail,    // 5: 支付失败
 	"CLOSED":     OrderClosed,      // 6: 已关闭
+	"REVOKED":    OrderClosed,      // 10: 已撤销（付款码支付）
+	"REFUND":     OrderToRefund,    // 6: 转入退款
+	"ACCEPT":     OrderUserPaying,  // 3: 委托代扣已受理，等待扣款
+	"PAY_FAIL":   OrderPaidFail,    // 5: 委托代扣扣款失败
+}
+
+// 退款状态和Status映射
+var mapRefundStatusToStatus = map[string]int64{
+	"SUCCESS":     OrderRefundSuccess, // 8: 退款成功
+	"PROCESSING":  OrderRefunding,     // 7: 退款处理中
+	"CHANGE":      OrderRefundFail,    // 9: 退款异常
+	"REFUNDCLOSE": OrderRefundFail,    // 9: 退款关闭
+}
+
+// 下单可选参数，订单失效时间不能早于minExpire
+func appendChargeOptions(params map[string]string, chargeParam *ChargeParam, minExpire time.Duration) error {
+	if chargeParam.ExpireTime != nil {
+		timeStart := time.Now()
+		if chargeParam.ExpireTime.Sub(timeStart) < minExpire {
+			return errors.New(fmt.Sprintf("wx time_expire must be at least %s after time_start", minExpire))
+		}
+		params["time_start"] = FormatPayTime(timeStart, DateFullLayoutWithoutSplit)                // 【非必传】订单生成时间，格式为yyyyMMddHHmmss
+		params["time_expire"] = FormatPayTime(*chargeParam.ExpireTime, DateFullLayoutWithoutSplit) // 【非必传】订单失效时间，格式为yyyyMMddHHmmss
+	}
+	if IsNotEmpty(chargeParam.Attach) {
+		params["attach"] = chargeParam.Attach // 【非必传】附加数据，在查询API和支付通知中原样返回
+	}
+	if IsNotEmpty(chargeParam.GoodsTag) {
+		params["goods_tag"] = chargeParam.GoodsTag // 【非必传】订单优惠标记
+	}
+	if chargeParam.NoCredit {
+		params["limit_pay"] = "no_credit" // 【非必传】指定支付方式，no_credit--指定不能使用信用卡支付
+	}
+	if chargeParam.Receipt {
+		params["receipt"] = "Y" // 【非必传】电子发票入口开放标识
+	}
+	if chargeParam.OrderDetail != nil {
+		err := checkOrderDetail(chargeParam.OrderDetail, chargeParam.TotalFee)
+		if err != nil {
+			return err
+		}
+		params["detail"] = Marshal(toWxDetail(chargeParam.OrderDetail)) // 【非必传】商品详情，单品优惠活动使用
+	}
+	return nil
+}
+
+// 商品金额合计需要等于订单原价，没有订单原价时等于订单总金额
+func checkOrderDetail(orderDetail *OrderDetail, totalFee int64) error {
+	if orderDetail.CostPrice > 0 {
+		totalFee = orderDetail.CostPrice
+	}
+	if orderDetail.GoodsTotalFee() != totalFee {
+		return errors.New("orderDetail, goods total fee not equal to costPrice or totalFee")
+	}
+	return nil
+}
+
+// 商品详情，单品优惠 https://pay.weixin.qq.com/wiki/doc/api/danpin.php?chapter=9_102&index=2
+func toWxDetail(orderDetail *OrderDetail) map[string]interface{} {
+	var goodsDetail []map[string]interface{}
+	for _, goods := range orderDetail.GoodsDetail {
+		item := map[string]interface{}{
+			"goods_id": goods.GoodsID,  // 【必传】商品编码
+			"quantity": goods.Quantity, // 【必传】商品数量
+			"price":    goods.Price,    // 【必传】商品单价，单位为分
+		}
+		if IsNotEmpty(goods.ThirdGoodsID) {
+			item["wxpay_goods_id"] = goods.ThirdGoodsID // 【非必传】微信支付定义的统一商品编号
+		}
+		if IsNotEmpty(goods.GoodsName) {
+			item["goods_name"] = goods.GoodsName // 【非必传】商品名称
+		}
+		goodsDetail = append(goodsDetail, item)
+	}
+
+	detail := map[string]interface{}{
+		"goods_detail": goodsDetail, // 【必传】单品信息
+	}
+	if orderDetail.CostPrice > 0 {
+		detail["cost_price"] = orderDetail.CostPrice // 【非必传】订单原价
+	}
+	if IsNotEmpty(orderDetail.ReceiptID) {
+		detail["receipt_id"] = orderDetail.ReceiptID // 【非必传】商品小票ID
+	}
+	return detail
+}
+
+// 解析以_$n结尾的代金券字段
+func parseCoupons(params map[string]string, couponCount int64) []*WxCoupon {
+	var coupons []*WxCoupon
+	for n := int64(0); n < couponCount; n++ {
+		couponFee, _ := strconv.ParseInt(params[fmt.Sprintf("coupon_fee_%d", n)], 10, 64)
+		coupons = append(coupons, &WxCoupon{
+			CouponType: params[fmt.Sprintf("coupon_type_%d", n)],
+			CouponID:   params[fmt.Sprintf("coupon_id_%d", n)],
+			CouponFee:  couponFee,
+		})
+	}
+	return coupons
+}
+
+// 填充订单实付、应结和优惠金额，免充值券(NO_CASH)由商户出资，充值代金券(CASH)由微信或其他出资方出资
+func fillOrderQueryFees(object *OrderQueryObject, result *ResponseResultCodeSuccess) {
+	object.CashFee = result.CashFee
+	object.SettlementFee = result.SettlementTotalFee
+	if object.SettlementFee == 0 { // 未使用免充值券时不返回，应结订单金额等于订单金额
+		object.SettlementFee = result.TotalFee
+	}
+	object.DiscountFee = result.CouponFee
+	for _, coupon := range result.Coupons {
+		discount := &Discount{
+			ID:   coupon.CouponID,
+			Type: coupon.CouponType,
+			Fee:  coupon.CouponFee,
+		}
+		if coupon.CouponType == "NO_CASH" {
+			discount.MerchantFee = coupon.CouponFee
+		} else {
+			discount.OtherFee = coupon.CouponFee
+		}
+		object.Discounts = append(object.Discounts, discount)
+	}
+}
+
+// 解析退款查询中以_$n结尾的退款字段
+func parseRefundQueryItems(params map[string]string, refundCount int64) []*WxRefundQueryItem {
+	var items []*WxRefundQueryItem
+	for n := int64(0); n < refundCount; n++ {
+		value := func(name string) string {
+			return params[fmt.Sprintf("%s_%d", name, n)]
+		}
+		intValue := func(name string) int64 {
+			result, _ := strconv.ParseInt(value(name), 10, 64)
+			return result
+		}
+
+		item := &WxRefundQueryItem{
+			OutRefundNo:         value("out_refund_no"),
+			RefundID:            value("refund_id"),
+			RefundChannel:       value("refund_channel"),
+			RefundFee:           intValue("refund_fee"),
+			SettlementRefundFee: intValue("settlement_refund_fee"),
+			CouponRefundFee:     intValue("coupon_refund_fee"),
+			CouponRefundCount:   intValue("coupon_refund_count"),
+			RefundStatus:        value("refund_status"),
+			RefundAccount:       value("refund_account"),
+			RefundRecvAccout:    value("refund_recv_accout"),
+			RefundSuccessTime:   value("refund_success_time"),
+		}
+		for m := int64(0); m < item.CouponRefundCount; m++ {
+			couponFee, _ := strconv.ParseInt(params[fmt.Sprintf("coupon_refund_fee_%d_%d", n, m)], 10, 64)
+			item.Coupons = append(item.Coupons, &WxRefundCoupon{
+				CouponType:      params[fmt.Sprintf("coupon_type_%d_%d", n, m)],
+				CouponRefundID:  params[fmt.Sprintf("coupon_refund_id_%d_%d", n, m)],
+				CouponRefundFee: couponFee,
+			})
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func toRefundQueryItem(item *WxRefundQueryItem) *RefundQueryItem {
+	var orderRefundStatus int64 = OrderRefunding
+	if status, ok := mapRefundStatusToStatus[item.RefundStatus]; ok {
+		orderRefundStatus = status
+	}
+
+	result := &RefundQueryItem{
+		RefundID:            item.OutRefundNo,
+		Status:              orderRefundStatus,
+		ThirdRefundID:       item.RefundID,
+		ThirdRefundFee:      item.RefundFee,
+		SettlementRefundFee: item.SettlementRefundFee,
+		CouponRefundFee:     item.CouponRefundFee,
+		RefundChannel:       item.RefundChannel,
+		RefundRecvAccount:   item.RefundRecvAccout,
+		RefundTime:          GetDateFullTime(item.RefundSuccessTime),
+	}
+	for _, coupon := range item.Coupons {
+		result.Coupons = append(result.Coupons, &RefundCoupon{
+			CouponID:        coupon.CouponRefundID,
+			CouponType:      coupon.CouponType,
+			CouponRefundFee: coupon.CouponRefundFee,
+		})
+	}
+	return result
+}
+
+// 服务商模式，请求中指定的子商户优先于WxClient上配置的子商户，返回实际使用的子商户
+// 请求中只指定了SubAppID而没有SubMchID时返回错误，避免sub_appid被配置的子商户覆盖
+func (client *WxClient) appendSubMerchantParams(params map[string]string, subMerchant SubMerchant) (SubMerchant, error) {
+	if IsNotEmpty(subMerchant.SubAppID) && IsEmpty(subMerchant.SubMchID) {
+		return subMerchant, errors.New("subAppID is set but subMchID is NULL")
+	}
+	if IsEmpty(subMerchant.SubMchID) {
+		subMerchant = SubMerchant{SubAppID: client.SubAppID, SubMchID: client.SubMchID}
+	}
+	if IsNotEmpty(subMerchant.SubMchID) {
+		params["sub_mch_id"] = subMerchant.SubMchID // 【服务商必传】微信支付分配的子商户号
+	}
+	if IsNotEmpty(subMerchant.SubAppID) {
+		params["sub_appid"] = subMerchant.SubAppID // 【服务商非必传】微信分配的子商户公众账号ID
+	}
+	return subMerchant, nil
 }
 
 func (client *WxClient) appendBasicParams(params map[string]string) map[string]string {
-	params["appid"] = client.AppID        // 【必传】微信开放平台审核通过的应用APPID
-	params["mch_id"] = client.MchID       // 【必传】微信支付分配的商户号
-	params["nonce_str"] = NonceStr()      // 【必传】随机字符串，不长于32位
-	params["sign_type"] = client.SignType // 【非必传】签名类型，目前支持HMAC-SHA256和MD5，默认为MD5
-	params["sign"] = client.sign(params)  // 【必传】签名
+	return client.appendBasicParamsWithSignType(params, client.SignType)
+}
+
+// 使用指定的签名类型，如分账接口仅支持HMAC-SHA256；沙盒环境仅支持MD5
+func (client *WxClient) appendBasicParamsWithSignType(params map[string]string, signType string) map[string]string {
+	if client.IsSandbox {
+		signType = SignTypeMd5
+	}
+	params["appid"] = client.AppID                                          // 【必传】微信开放平台审核通过的应用APPID
+	params["mch_id"] = client.MchID                                         // 【必传】微信支付分配的商户号
+	params["nonce_str"] = NonceStr()                                        // 【必传】随机字符串，不长于32位
+	params["sign_type"] = signType                                          // 【非必传】签名类型，目前支持HMAC-SHA256和MD5，默认为MD5
+	params["sign"] = client.signWithKey(params, signType, client.signKey()) // 【必传】签名
 	return params
 }
 
-// 请求
+// 请求，按ReportLevel异步上报接口调用结果
 func (client *WxClient) postWithXml(useAppCert bool, url string, params map[string]string) (string, error) {
-	hc, err := client.getHttpClient(useAppCert)
+	return client.postWithXmlAndReport(useAppCert, url, params, client.needReport(url, false))
+}
+
+// 请求，report为true时异步上报接口调用结果
+func (client *WxClient) postWithXmlAndReport(useAppCert bool, url string, params map[string]string, report bool) (string, error) {
+	startTime := time.Now()
+	xmlStr, err := client.doPostWithXml(useAppCert, url, params)
+
+	// 沙盒密钥已失效时，重新获取沙盒密钥后重试一次
+	if err == nil && client.IsSandbox {
+		var respObject ResponseReturnCode
+		if xml.Unmarshal([]byte(xmlStr), &respObject) == nil &&
+			respObject.ReturnCode == Fail && strings.Contains(respObject.ReturnMsg, "签名") {
+			client.resetSandboxSignKey()
+			xmlStr, err = client.doPostWithXml(useAppCert, url, params)
+		}
+	}
+
+	if report {
+		go client.report(url, params["out_trade_no"], params["spbill_create_ip"], xmlStr, err, startTime)
+	}
 	if err != nil {
 		return "", err
 	}
-	resp, err := hc.Post(url, MIMEApplicationXML, strings.NewReader(MapToXml(params)))
+	return xmlStr, nil
+}
+
+func (client *WxClient) doPostWithXml(useAppCert bool, url string, params map[string]string) (string, error) {
+	resp, err := client.post(useAppCert, url, params)
 	if err != nil {
 		return "", err
 	}
@@ -319,6 +729,74 @@ func (client *WxClient) postWithXml(useAppCert bool, url string, params map[stri
 	return string(respBody), nil
 }
 
+// 请求，由调用方关闭resp.Body，用于下载对账单等需要按流读取响应的接口
+func (client *WxClient) post(useAppCert bool, url string, params map[string]string) (*http.Response, error) {
+	hc, err := client.getHttpClient(useAppCert)
+	if err != nil {
+		return nil, err
+	}
+	return client.postWithClient(hc, url, params)
+}
+
+// 使用指定的http.Client请求，如交易保障上报需要较短的超时时间
+func (client *WxClient) postWithClient(hc *http.Client, url string, params map[string]string) (*http.Response, error) {
+	if client.IsSandbox { // 沙盒环境使用沙盒密钥重新签名，仅支持MD5
+		key, err := client.getSandboxSignKey()
+		if err != nil {
+			return nil, err
+		}
+		params[Sign] = client.signWithKey(params, SignTypeMd5, key)
+	}
+	return hc.Post(url, MIMEApplicationXML, strings.NewReader(MapToXml(params)))
+}
+
+// 获取沙盒密钥，缓存的密钥过期后重新获取
+func (client *WxClient) getSandboxSignKey() (string, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if IsNotEmpty(client.sandboxSignKey) && time.Now().Before(client.sandboxSignKeyExpireAt) {
+		return client.sandboxSignKey, nil
+	}
+
+	// 获取沙盒密钥使用正式API密钥签名，仅支持MD5
+	params := make(map[string]string)
+	params["mch_id"] = client.MchID  // 【必传】微信支付分配的商户号
+	params["nonce_str"] = NonceStr() // 【必传】随机字符串，不长于32位
+	params["sign"] = client.signWithKey(params, SignTypeMd5, client.ApiKey)
+
+	hc := &http.Client{}
+	resp, err := hc.Post(SandboxGetSignKeyUrl, MIMEApplicationXML, strings.NewReader(MapToXml(params)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var respObject WxSandboxSignKeyResponse
+	err = xml.Unmarshal(respBody, &respObject)
+	if err != nil {
+		return "", err
+	}
+	if respObject.ReturnCode != Success || IsEmpty(respObject.SandboxSignKey) {
+		return "", errors.New(respObject.ReturnMsg)
+	}
+
+	client.sandboxSignKey = respObject.SandboxSignKey
+	client.sandboxSignKeyExpireAt = time.Now().Add(sandboxSignKeyTTL)
+	return client.sandboxSignKey, nil
+}
+
+// 清除缓存的沙盒密钥，沙盒返回签名错误时调用
+func (client *WxClient) resetSandboxSignKey() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.sandboxSignKey = ""
+}
+
 func (client *WxClient) getHttpClient(useAppCert bool) (*http.Client, error) {
 	var hc *http.Client
 	if useAppCert { // 退款需要app证书
@@ -345,6 +823,23 @@ func (client *WxClient) getHttpClient(useAppCert bool) (*http.Client, error) {
 
 // 签名
 func (client *WxClient) sign(params map[string]string) string {
+	return client.signWithKey(params, client.SignType, client.signKey())
+}
+
+// 签名密钥，沙盒环境使用沙盒密钥
+func (client *WxClient) signKey() string {
+	if client.IsSandbox {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if IsNotEmpty(client.sandboxSignKey) {
+			return client.sandboxSignKey
+		}
+	}
+	return client.ApiKey
+}
+
+// 使用指定的签名类型和密钥签名，签名类型为空时使用MD5
+func (client *WxClient) signWithKey(params map[string]string, signType string, key string) string {
 	delete(params, "sign")
 	delete(params, "key")
 	var paramArray []string
@@ -356,16 +851,16 @@ func (client *WxClient) sign(params map[string]string) string {
 
 	sort.Strings(paramArray)
 	paramStr := strings.Join(paramArray, "&")
-	paramStr = paramStr + "&key=" + client.ApiKey
+	paramStr = paramStr + "&key=" + key
 
 	var result string
 
-	switch client.SignType {
-	case SignTypeMd5:
+	switch signType {
+	case SignTypeMd5, "":
 		dataMd5 := md5.Sum([]byte(paramStr))
 		result = hex.EncodeToString(dataMd5[:])
 	case SignTypeHmacSha256:
-		h := hmac.New(sha256.New, []byte(client.ApiKey))
+		h := hmac.New(sha256.New, []byte(key))
 		h.Write([]byte(paramStr))
 		dataSha256 := h.Sum(nil)
 		result = hex.EncodeToString(dataSha256[:])
@@ -374,11 +869,37 @@ func (client *WxClient) sign(params map[string]string) string {
 	return strings.ToUpper(result)
 }
 
+// 验证响应签名，return_code为SUCCESS时微信会对响应签名
+func (client *WxClient) checkResponseSign(xmlStr string) error {
+	return client.checkResponseSignWithType(xmlStr, client.SignType)
+}
+
+func (client *WxClient) checkResponseSignWithType(xmlStr string, signType string) error {
+	if client.SkipResponseSignCheck {
+		return nil
+	}
+	params, err := XmlToMap(xmlStr)
+	if err != nil {
+		return err
+	}
+	if !client.checkSignWithType(params, signType) {
+		return ErrSignVerifyFail
+	}
+	return nil
+}
+
 // 验证签名
 func (client *WxClient) checkSign(params map[string]string) bool {
+	return client.checkSignWithType(params, client.SignType)
+}
+
+func (client *WxClient) checkSignWithType(params map[string]string, signType string) bool {
+	if client.IsSandbox { // 沙盒环境仅支持MD5
+		signType = SignTypeMd5
+	}
 	value, ok := params[Sign]
 	if !ok {
 		return false
 	}
-	return value == client.sign(params)
+	return value == client.signWithKey(params, signType, client.signKey())
 }
@@ -0,0 +1,218 @@
+package wx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	. "github.com/bmbstack/gopay/common"
+	"strconv"
+)
+
+//===================================================================
+//					   海关报关
+//	微信官方文档 https://pay.weixin.qq.com/wiki/doc/api/external/declarecustom.php?chapter=18_1
+//
+//  报关接口仅支持MD5签名，不需要API证书；没有沙盒环境。
+//  拆单报关时每个子订单单独报关，子订单的应付金额需等于物流费与商品价格之和
+//===================================================================
+const (
+	CustomsDeclareOrderUrl     = "https://api.mch.weixin.qq.com/cgi-bin/mch/customs/customdeclareorder"
+	CustomsDeclareQueryUrl     = "https://api.mch.weixin.qq.com/cgi-bin/mch/customs/customdeclarequery"
+	CustomsDeclareRedeclareUrl = "https://api.mch.weixin.qq.com/cgi-bin/mch/newcustoms/customdeclareredeclare"
+
+	CustomsActionAdd    = "ADD"    // 报关类型，新增
+	CustomsActionModify = "MODIFY" // 报关类型，修改
+
+	CustomsStateUndeclared = "UNDECLARED" // 报关状态，未申报
+	CustomsStateSubmitted  = "SUBMITTED"  // 报关状态，申报已提交
+	CustomsStateProcessing = "PROCESSING" // 报关状态，申报中
+	CustomsStateSuccess    = "SUCCESS"    // 报关状态，申报成功
+	CustomsStateFail       = "FAIL"       // 报关状态，申报失败
+	CustomsStateExcept     = "EXCEPT"     // 报关状态，海关接口异常
+)
+
+// CustomsDeclare 订单附加信息提交 https://pay.weixin.qq.com/wiki/doc/api/external/declarecustom.php?chapter=18_1
+// 拆单报关时按子订单依次提交，某个子订单失败时返回已提交成功的子订单结果和错误
+func (client *WxClient) CustomsDeclare(param *CustomsDeclareParam) ([]*WxCustomsDeclareResponse, error) {
+	for _, subOrder := range param.SubOrders {
+		if subOrder.OrderFee != subOrder.TransportFee+subOrder.ProductFee {
+			return nil, errors.New(fmt.Sprintf("sub order %s, order_fee not equal to transport_fee + product_fee", subOrder.SubOrderNO))
+		}
+	}
+
+	if len(param.SubOrders) == 0 { // 不拆单
+		respObject, err := client.customsDeclare(param, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []*WxCustomsDeclareResponse{respObject}, nil
+	}
+
+	var results []*WxCustomsDeclareResponse
+	for _, subOrder := range param.SubOrders {
+		respObject, err := client.customsDeclare(param, subOrder)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, respObject)
+	}
+	return results, nil
+}
+
+// CustomsDeclareQuery 订单附加信息查询 https://pay.weixin.qq.com/wiki/doc/api/external/declarecustom.php?chapter=18_2
+func (client *WxClient) CustomsDeclareQuery(param *CustomsQueryParam) (*WxCustomsDeclareQueryResponse, error) {
+	params := make(map[string]string)
+	params["customs"] = param.Customs // 【必传】海关
+	if IsNotEmpty(param.OrderID) {
+		params["out_trade_no"] = param.OrderID // 【四选一】商户订单号
+	}
+	if IsNotEmpty(param.ThirdOrderID) {
+		params["transaction_id"] = param.ThirdOrderID // 【四选一】微信支付订单号
+	}
+	if IsNotEmpty(param.SubOrderNO) {
+		params["sub_order_no"] = param.SubOrderNO // 【四选一】商户子订单号
+	}
+	if IsNotEmpty(param.SubOrderID) {
+		params["sub_order_id"] = param.SubOrderID // 【四选一】微信子订单号
+	}
+
+	var respObject WxCustomsDeclareQueryResponse
+	xmlStr, err := client.postCustoms(CustomsDeclareQueryUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	values, err := XmlToMap(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	respObject.SubOrders = parseCustomsSubOrders(values, respObject.Count)
+	return &respObject, nil
+}
+
+// CustomsRedeclare 订单附加信息重推 https://pay.weixin.qq.com/wiki/doc/api/external/declarecustom.php?chapter=18_4
+func (client *WxClient) CustomsRedeclare(param *CustomsRedeclareParam) (*WxCustomsRedeclareResponse, error) {
+	params := make(map[string]string)
+	params["customs"] = param.Customs             // 【必传】海关
+	params["mch_customs_no"] = param.MchCustomsNO // 【必传】商户海关备案号
+	if IsNotEmpty(param.OrderID) {
+		params["out_trade_no"] = param.OrderID // 【二选一】商户订单号
+	}
+	if IsNotEmpty(param.ThirdOrderID) {
+		params["transaction_id"] = param.ThirdOrderID // 【二选一】微信支付订单号
+	}
+	if IsNotEmpty(param.SubOrderNO) {
+		params["sub_order_no"] = param.SubOrderNO // 【拆单必传】商户子订单号
+	}
+	if IsNotEmpty(param.SubOrderID) {
+		params["sub_order_id"] = param.SubOrderID // 【拆单必传】微信子订单号
+	}
+
+	var respObject WxCustomsRedeclareResponse
+	_, err := client.postCustoms(CustomsDeclareRedeclareUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+// 提交订单附加信息，subOrder为空时不拆单
+func (client *WxClient) customsDeclare(param *CustomsDeclareParam, subOrder *CustomsSubOrder) (*WxCustomsDeclareResponse, error) {
+	params := make(map[string]string)
+	params["out_trade_no"] = param.OrderID        // 【必传】商户订单号
+	params["transaction_id"] = param.ThirdOrderID // 【必传】微信支付订单号
+	params["customs"] = param.Customs             // 【必传】海关
+	params["mch_customs_no"] = param.MchCustomsNO // 【必传】商户海关备案号
+	if param.Duty > 0 {
+		params["duty"] = strconv.FormatInt(param.Duty, 10) // 【非必传】关税，单位为分
+	}
+	if IsNotEmpty(param.ActionType) {
+		params["action_type"] = param.ActionType // 【非必传】报关类型 ADD/MODIFY
+	}
+	if IsNotEmpty(param.CertID) {
+		params["cert_type"] = param.CertType // 【非必传】证件类型
+		params["cert_id"] = param.CertID     // 【非必传】证件号码
+		params["name"] = param.Name          // 【非必传】姓名
+	}
+	if subOrder != nil {
+		feeType := subOrder.FeeType
+		if IsEmpty(feeType) {
+			feeType = "CNY"
+		}
+		params["sub_order_no"] = subOrder.SubOrderNO                           // 【拆单必传】商户子订单号
+		params["fee_type"] = feeType                                           // 【拆单必传】币种，暂只支持CNY
+		params["order_fee"] = strconv.FormatInt(subOrder.OrderFee, 10)         // 【拆单必传】子订单应付金额
+		params["transport_fee"] = strconv.FormatInt(subOrder.TransportFee, 10) // 【拆单必传】物流费
+		params["product_fee"] = strconv.FormatInt(subOrder.ProductFee, 10)     // 【拆单必传】商品价格
+	}
+
+	var respObject WxCustomsDeclareResponse
+	_, err := client.postCustoms(CustomsDeclareOrderUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+// 解析报关查询中以_$n结尾的子订单字段
+func parseCustomsSubOrders(params map[string]string, count int64) []*WxCustomsSubOrderState {
+	var subOrders []*WxCustomsSubOrderState
+	for n := int64(0); n < count; n++ {
+		value := func(name string) string {
+			return params[fmt.Sprintf("%s_%d", name, n)]
+		}
+		intValue := func(name string) int64 {
+			result, _ := strconv.ParseInt(value(name), 10, 64)
+			return result
+		}
+
+		subOrders = append(subOrders, &WxCustomsSubOrderState{
+			SubOrderNO:      value("sub_order_no"),
+			SubOrderID:      value("sub_order_id"),
+			MchCustomsNO:    value("mch_customs_no"),
+			Customs:         value("customs"),
+			CertCheckResult: value("cert_check_result"),
+			FeeType:         value("fee_type"),
+			OrderFee:        intValue("order_fee"),
+			Duty:            intValue("duty"),
+			TransportFee:    intValue("transport_fee"),
+			ProductFee:      intValue("product_fee"),
+			State:           value("state"),
+			Explanation:     value("explanation"),
+			ModifyTime:      value("modify_time"),
+		})
+	}
+	return subOrders
+}
+
+// 报关请求，使用MD5签名，校验响应签名，返回响应原文
+func (client *WxClient) postCustoms(requestUrl string, params map[string]string, respObject interface{}) (string, error) {
+	if client.IsSandbox { // 报关接口没有沙盒环境
+		return "", ErrSandboxNotSupported
+	}
+	params["appid"] = client.AppID    // 【必传】公众账号ID
+	params["mch_id"] = client.MchID   // 【必传】商户号
+	params["sign_type"] = SignTypeMd5 // 【必传】签名类型，暂只支持MD5
+	params["sign"] = client.signWithKey(params, SignTypeMd5, client.ApiKey)
+
+	xmlStr, err := client.doPostWithXml(false, requestUrl, params)
+	if err != nil {
+		return "", err
+	}
+
+	var baseCode ResponseBaseCode
+	err = xml.Unmarshal([]byte(xmlStr), &baseCode)
+	if err != nil {
+		return "", err
+	}
+	if baseCode.ReturnCode != Success { // 通信失败
+		return "", errors.New(baseCode.ReturnMsg)
+	}
+	err = client.checkResponseSignWithType(xmlStr, SignTypeMd5)
+	if err != nil {
+		return "", err
+	}
+	if baseCode.ResultCode != Success { // 业务失败
+		return "", errors.New(baseCode.ErrCodeDes)
+	}
+	return xmlStr, xml.Unmarshal([]byte(xmlStr), respObject)
+}
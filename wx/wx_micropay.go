@@ -0,0 +1,202 @@
+package wx
+
+import (
+	"encoding/xml"
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+	"strconv"
+	"time"
+)
+
+// 付款码支付结果未知的错误码，需要查询订单确认支付结果
+var microPayUnknownErrCodes = map[string]bool{
+	"USERPAYING":  true, // 用户支付中，需要输入密码
+	"SYSTEMERROR": true, // 接口返回错误
+	"BANKERROR":   true, // 银行系统异常
+}
+
+// MicroPay 付款码支付 https://pay.weixin.qq.com/wiki/doc/api/micropay.php?chapter=9_10&index=1
+// 支付结果未知时按MicroPayPolling轮询查询订单，超时仍未支付成功则撤销订单
+// 支付失败或撤销失败时，同时返回带最终状态的ChargeObject和错误
+func (client *WxClient) MicroPay(chargeParam *ChargeParam) (*ChargeObject, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxMicroPayUrl
+	} else {
+		requestUrl = MicroPayUrl
+	}
+
+	params := make(map[string]string)
+	params["out_trade_no"] = chargeParam.OrderID                      // 【必传】商户系统内部订单号，要求32个字符内，只能是数字、大小写字母_-|*且在同一个商户号下唯一
+	params["total_fee"] = strconv.FormatInt(chargeParam.TotalFee, 10) // 【必传】订单总金额，单位为分
+	params["body"] = chargeParam.Description                          // 【必传】商品描述
+	params["spbill_create_ip"] = chargeParam.ClientIP                 // 【必传】终端IP
+	params["auth_code"] = chargeParam.AuthCode                        // 【必传】付款码，扫码设备读取用户微信中的条码或者二维码信息
+	if chargeParam.ProfitSharing {
+		params["profit_sharing"] = "Y" // 【非必传】是否需要分账 Y-是，需要分账 N-否，不分账
+	}
+	err := appendChargeOptions(params, chargeParam, microPayMinExpire)
+	if err != nil {
+		return nil, err
+	}
+	_, err = client.appendSubMerchantParams(params, chargeParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+	params = client.appendBasicParams(params)
+
+	// ChargeObject
+	object := &ChargeObject{}
+	object.ChargeParam = chargeParam
+
+	// 请求失败、响应解析失败或验签失败时支付结果未知，同样需要查询订单
+	var respObject *WxMicroPayResponse
+	xmlStr, err := client.postWithXml(false, requestUrl, params)
+	if err == nil {
+		respObject = client.parseMicroPayResponse(xmlStr)
+	}
+	if respObject != nil {
+		if respObject.ReturnCode != Success { // 通信失败
+			return nil, errors.New(respObject.ReturnMsg)
+		}
+		if respObject.ResultCode == Success { // 支付成功
+			object.Status = OrderPaidSuccess
+			object.ThirdOrderID = respObject.TransactionID
+			return object, nil
+		}
+		if !microPayUnknownErrCodes[respObject.ErrCode] { // 支付失败
+			object.Status = OrderPaidFail
+			return object, errors.New(respObject.ErrCodeDes)
+		}
+	}
+
+	return client.waitMicroPay(object)
+}
+
+// 解析付款码支付响应，响应解析失败或验签失败时返回nil
+func (client *WxClient) parseMicroPayResponse(xmlStr string) *WxMicroPayResponse {
+	var respObject WxMicroPayResponse
+	if xml.Unmarshal([]byte(xmlStr), &respObject) != nil {
+		return nil
+	}
+	if respObject.ReturnCode == Success && client.checkResponseSign(xmlStr) != nil {
+		return nil
+	}
+	return &respObject
+}
+
+// Reverse 撤销订单 https://pay.weixin.qq.com/wiki/doc/api/micropay.php?chapter=9_11&index=3
+// 请求失败或撤销失败且recall=Y时，间隔MicroPayPolling.Interval后重试，最多重试ReverseRetry次
+func (client *WxClient) Reverse(orderQueryParam *OrderQueryParam) error {
+	polling := client.getMicroPayPolling()
+	for i := 0; ; i++ {
+		respObject, err := client.reverse(orderQueryParam)
+		if err == nil {
+			if respObject.ResultCode == Success {
+				return nil
+			}
+			if respObject.Recall != "Y" {
+				return errors.New(respObject.ErrCodeDes)
+			}
+			err = errors.New(respObject.ErrCodeDes)
+		}
+		if i >= polling.ReverseRetry {
+			return err
+		}
+		time.Sleep(polling.Interval)
+	}
+}
+
+// 轮询查询订单，直到支付成功、支付失败或超时，支付未成功时撤销订单
+// 撤销失败时返回最后查询到的状态和错误
+func (client *WxClient) waitMicroPay(object *ChargeObject) (*ChargeObject, error) {
+	polling := client.getMicroPayPolling()
+	orderQueryParam := &OrderQueryParam{
+		PayType:     PayTypeWx,
+		PayChannel:  PayChannelWxMicro,
+		SubMerchant: object.ChargeParam.SubMerchant,
+		OrderID:     object.ChargeParam.OrderID,
+	}
+
+	var status int64 = OrderUserPaying
+	deadline := time.Now().Add(polling.Timeout)
+	for status == OrderUserPaying && time.Now().Before(deadline) {
+		time.Sleep(polling.Interval)
+
+		queryObject, err := client.OrderQuery(orderQueryParam)
+		if err != nil { // 订单不存在或查询失败，继续查询
+			continue
+		}
+		switch queryObject.Status {
+		case OrderPaidSuccess:
+			object.Status = OrderPaidSuccess
+			object.ThirdOrderID = queryObject.ThirdOrderID
+			return object, nil
+		case OrderToRefund: // 已支付并转入退款，不能撤销
+			object.Status = OrderToRefund
+			object.ThirdOrderID = queryObject.ThirdOrderID
+			return object, nil
+		case OrderUserPaying, OrderWaitPay:
+			// 继续等待用户支付
+		default:
+			status = queryObject.Status
+		}
+	}
+
+	// 超时或支付失败，撤销订单
+	err := client.Reverse(orderQueryParam)
+	if err != nil {
+		object.Status = status
+		return object, err
+	}
+	if status == OrderPaidFail {
+		object.Status = OrderPaidFail
+	} else {
+		object.Status = OrderClosed
+	}
+	return object, nil
+}
+
+func (client *WxClient) reverse(orderQueryParam *OrderQueryParam) (*WxReverseResponse, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxReverseUrl
+	} else {
+		requestUrl = ReverseUrl
+	}
+
+	params := make(map[string]string)
+	params["out_trade_no"] = orderQueryParam.OrderID // 【必传】商户系统内部订单号
+	_, err := client.appendSubMerchantParams(params, orderQueryParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+	params = client.appendBasicParams(params)
+
+	// 微信支付接口中，涉及资金回滚的接口会使用到API证书，包括退款、撤销接口。
+	xmlStr, err := client.postWithXml(true, requestUrl, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxReverseResponse
+	err = xml.Unmarshal([]byte(xmlStr), &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ReturnCode != Success { // 通信失败
+		return nil, errors.New(respObject.ReturnMsg)
+	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+func (client *WxClient) getMicroPayPolling() *MicroPayPolling {
+	if client.MicroPayPolling != nil {
+		return client.MicroPayPolling
+	}
+	return DefaultMicroPayPolling
+}
@@ -0,0 +1,117 @@
+package wx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	. "github.com/bmbstack/gopay/common"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//===================================================================
+//					   扫码支付模式一
+//	微信官方文档 https://pay.weixin.qq.com/wiki/doc/api/native.php?chapter=6_4
+//
+//  商户根据商品ID生成固定的二维码链接，用户扫码后微信回调商户的支付回调URL，
+//  商户统一下单后返回prepay_id，由微信向用户展示支付页面
+//===================================================================
+const NativeBizPayUrl = "weixin://wxpay/bizpayurl"
+
+// WxNativeCallback 根据扫码回调生成下单参数，返回错误时微信向用户展示错误信息
+// PayChannel为空时使用NATIVE，ProductID为空时使用回调中的商品ID
+type WxNativeCallback func(notify *WxNativeNotify) (*ChargeParam, error)
+
+// NativeBizPayURL 生成扫码支付模式一的二维码链接 https://pay.weixin.qq.com/wiki/doc/api/native.php?chapter=6_4
+func (client *WxClient) NativeBizPayURL(productID string) string {
+	params := make(map[string]string)
+	params["appid"] = client.AppID                                             // 【必传】公众账号ID
+	params["mch_id"] = client.MchID                                            // 【必传】商户号
+	params["time_stamp"] = strconv.FormatInt(time.Now().Unix(), 10)            // 【必传】系统当前时间，10位
+	params["nonce_str"] = NonceStr()                                           // 【必传】随机字符串，不长于32位
+	params["product_id"] = productID                                           // 【必传】商品ID，回调时原样返回
+	params["sign"] = client.signWithKey(params, SignTypeMd5, client.signKey()) // 【必传】签名，模式一不带sign_type，使用MD5
+
+	return NativeBizPayUrl + "?" + MapToUrlValues(params).Encode()
+}
+
+// NativeCallbackHandler 扫码支付模式一的支付回调URL处理器
+func (client *WxClient) NativeCallbackHandler(callback WxNativeCallback) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body, err := ioutil.ReadAll(r.Body)
+		var reply string
+		if err != nil {
+			reply = NotifyReplyFail(err.Error())
+		} else {
+			reply = client.NativeCallbackReply(body, callback)
+		}
+		w.Header().Set("Content-Type", MIMEApplicationXML)
+		w.Write([]byte(reply))
+	})
+}
+
+// NativeCallbackReply 处理扫码支付模式一回调，body为微信POST的XML原文，返回需要回复给微信的XML
+func (client *WxClient) NativeCallbackReply(body []byte, callback WxNativeCallback) string {
+	params, err := XmlToMap(string(body))
+	if err != nil {
+		return NotifyReplyFail(err.Error())
+	}
+
+	// 模式一回调不带sign_type，使用MD5验证签名
+	if !client.checkSignWithType(params, SignTypeMd5) {
+		return NotifyReplyFail(ErrSignVerifyFail.Error())
+	}
+
+	var notify WxNativeNotify
+	err = xml.Unmarshal(body, &notify)
+	if err != nil {
+		return NotifyReplyFail(err.Error())
+	}
+
+	prepayID, err := client.nativeOrder(&notify, callback)
+
+	reply := make(map[string]string)
+	reply["return_code"] = Success  // 【必传】返回状态码
+	reply["appid"] = client.AppID   // 【必传】公众账号ID
+	reply["mch_id"] = client.MchID  // 【必传】商户号
+	reply["nonce_str"] = NonceStr() // 【必传】随机字符串
+	if err != nil {
+		reply["result_code"] = Fail         // 【必传】业务结果，失败时不返回prepay_id
+		reply["err_code_des"] = err.Error() // 【非必传】错误描述，展示给用户
+	} else {
+		reply["prepay_id"] = prepayID  // 【必传】预支付ID
+		reply["result_code"] = Success // 【必传】业务结果
+	}
+	reply["sign"] = client.signWithKey(reply, SignTypeMd5, client.signKey()) // 【必传】签名
+	return MapToXml(reply)
+}
+
+// 调用用户函数生成下单参数并统一下单，返回prepay_id
+func (client *WxClient) nativeOrder(notify *WxNativeNotify, callback WxNativeCallback) (string, error) {
+	if notify.AppID != client.AppID || notify.MchID != client.MchID {
+		return "", errors.New(fmt.Sprintf("wx native callback appid or mch_id not match: %s, %s", notify.AppID, notify.MchID))
+	}
+
+	chargeParam, err := callback(notify)
+	if err != nil {
+		return "", err
+	}
+	if chargeParam == nil {
+		return "", errors.New("chargeParam is NULL")
+	}
+	if IsEmpty(chargeParam.PayChannel) {
+		chargeParam.PayChannel = PayChannelWxNative
+	}
+	if IsEmpty(chargeParam.ProductID) {
+		chargeParam.ProductID = notify.ProductID
+	}
+
+	object, err := client.Order(chargeParam)
+	if err != nil {
+		return "", err
+	}
+	return object.PrepayID, nil
+}
@@ -0,0 +1,45 @@
+package wx
+
+import (
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+	"testing"
+)
+
+func TestNativeCallbackReplyRejectsOtherMerchant(t *testing.T) {
+	client := &WxClient{AppID: "wx2421b1c4370ec43b", MchID: "10000100", ApiKey: "192006250b4c09247ec02edce69f6a2d"}
+	tests := []struct {
+		name  string
+		appID string
+		mchID string
+	}{
+		{"appid", "wx0000000000000000", client.MchID},
+		{"mch_id", client.AppID, "10000200"},
+	}
+	for _, tt := range tests {
+		params := map[string]string{
+			"appid":        tt.appID,
+			"mch_id":       tt.mchID,
+			"openid":       "o8GeHuLAsgefS_80exEr1cTqekUs",
+			"is_subscribe": "N",
+			"nonce_str":    "5K8264ILTKCH16CQ2502SI8ZNMTM67VS",
+			"product_id":   "88888",
+		}
+		params["sign"] = client.signWithKey(params, SignTypeMd5, client.ApiKey)
+
+		called := false
+		reply, err := XmlToMap(client.NativeCallbackReply([]byte(MapToXml(params)), func(notify *WxNativeNotify) (*ChargeParam, error) {
+			called = true
+			return nil, errors.New("unexpected callback")
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if called {
+			t.Errorf("%s: callback called for other merchant", tt.name)
+		}
+		if reply["result_code"] != Fail || reply["prepay_id"] != "" {
+			t.Errorf("%s: unexpected reply: %v", tt.name, reply)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package wx
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	. "github.com/bmbstack/gopay/common"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// NotifyReplySuccess 通知处理成功时返回给微信的内容
+const NotifyReplySuccess = `<xml><return_code><![CDATA[SUCCESS]]></return_code><return_msg><![CDATA[OK]]></return_msg></xml>`
+
+// NotifyReplyFail 通知处理失败时返回给微信的内容，微信会按策略重新通知
+func NotifyReplyFail(msg string) string {
+	// msg中的"]]>"会提前结束CDATA，拆分成两段CDATA
+	msg = strings.Replace(msg, "]]>", "]]]]><![CDATA[>", -1)
+	return fmt.Sprintf(`<xml><return_code><![CDATA[FAIL]]></return_code><return_msg><![CDATA[%s]]></return_msg></xml>`, msg)
+}
+
+// NotifyReply 根据通知处理结果生成返回给微信的内容
+func NotifyReply(err error) string {
+	if err != nil {
+		return NotifyReplyFail(err.Error())
+	}
+	return NotifyReplySuccess
+}
+
+// ParseNotify 解析支付结果通知 https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_7
+func (client *WxClient) ParseNotify(r *http.Request) (*WxPayNotify, error) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return client.ParseNotifyBytes(body)
+}
+
+// ParseNotifyBytes 解析支付结果通知，body为微信POST的XML原文
+func (client *WxClient) ParseNotifyBytes(body []byte) (*WxPayNotify, error) {
+	params, err := XmlToMap(string(body))
+	if err != nil {
+		return nil, err
+	}
+	if params["return_code"] != Success { // 通信失败
+		return nil, errors.New(params["return_msg"])
+	}
+
+	// 使用商户密钥验证签名sign的有效性
+	if !client.checkSign(params) {
+		return nil, ErrSignVerifyFail
+	}
+
+	var notify WxPayNotify
+	err = xml.Unmarshal(body, &notify)
+	if err != nil {
+		return nil, err
+	}
+	notify.Coupons = parseCoupons(params, notify.CouponCount)
+
+	if IsNotEmpty(notify.TradeState) {
+		status, ok := mapTradeStateToStatus[notify.TradeState]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("unknown trade_state: %s", notify.TradeState))
+		}
+		notify.Status = status
+	} else if notify.ResultCode == Success {
+		notify.Status = OrderPaidSuccess // 4: 支付成功
+	} else {
+		notify.Status = OrderPaidFail // 5: 支付失败
+	}
+	return &notify, nil
+}
+
+// ParseRefundNotify 解析退款结果通知 https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_16&index=11
+func (client *WxClient) ParseRefundNotify(r *http.Request) (*RefundQueryObject, error) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return client.ParseRefundNotifyBytes(body)
+}
+
+// ParseRefundNotifyBytes 解析退款结果通知，body为微信POST的XML原文
+func (client *WxClient) ParseRefundNotifyBytes(body []byte) (*RefundQueryObject, error) {
+	var notify WxRefundNotify
+	err := xml.Unmarshal(body, &notify)
+	if err != nil {
+		return nil, err
+	}
+	if notify.ReturnCode != Success { // 通信失败
+		return nil, errors.New(notify.ReturnMsg)
+	}
+
+	reqInfo, err := client.DecryptRefundReqInfo(notify.ReqInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	status, ok := mapRefundStatusToStatus[reqInfo.RefundStatus]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown refund_status: %s", reqInfo.RefundStatus))
+	}
+
+	// RefundQueryObject
+	object := &RefundQueryObject{
+		OrderID:             reqInfo.OutTradeNO,
+		RefundID:            reqInfo.OutRefundNO,
+		Status:              status,
+		ThirdOrderID:        reqInfo.TransactionID,
+		ThirdOrderFee:       reqInfo.TotalFee,
+		ThirdRefundID:       reqInfo.RefundID,
+		ThirdRefundFee:      reqInfo.RefundFee,
+		SettlementRefundFee: reqInfo.SettlementRefundFee,
+		RefundTime:          GetDateFullTime(reqInfo.SuccessTime),
+		RefundRecvAccount:   reqInfo.RefundRecvAccout,
+	}
+	return object, nil
+}
+
+// DecryptRefundReqInfo 解密退款结果通知中的req_info
+// 1. 对加密串做base64解码
+// 2. 对商户key做md5，得到32位小写key
+// 3. 用key对base64解码后的内容做AES-256-ECB解密（PKCS7Padding）
+func (client *WxClient) DecryptRefundReqInfo(reqInfo string) (*WxRefundNotifyReqInfo, error) {
+	if IsEmpty(reqInfo) {
+		return nil, errors.New("req_info is empty")
+	}
+	data, err := base64.StdEncoding.DecodeString(reqInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	keyMd5 := md5.Sum([]byte(client.ApiKey))
+	key := hex.EncodeToString(keyMd5[:])
+	plain, err := AesEcbDecrypt(data, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var result WxRefundNotifyReqInfo
+	err = xml.Unmarshal(plain, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,71 @@
+package wx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	. "github.com/bmbstack/gopay/common"
+	"testing"
+)
+
+// 商户key为192006250b4c09247ec02edce69f6a2d时加密的退款结果通知req_info
+const testRefundReqInfo = "WBzGpzQuNpcFxIlFjUUD9BfnwwNUlVAs7bwvgHME4/STvCTiJl5s38uIX1NYSICMjGWrkvWnE43GfLJKmHP/eG0/OzOYIOgiSnagAjbdzc/Em0to7/yJIEmxqqDfhFvMTpRNy3oyb80yNxoDC6cXrdmPb8CY2u4n6KnBrlHXBf5DAX+ZlxUxfikXzsD16ZHzOUvtfJKvzZYOyT8/Qt7RRxITzrz4HL5jr56V0DFRbNOs1OPqiB3QjU7RqN4NiBYOUPiBoR1B1fBbcKln++dy11xjVAUyxB0an1sGa0StjDpvetP9yKOzYXa7lTQepo48ni6jPBG9e8yXCDQExNJGvV6fY5BUBzdXxWLK273IWyZ2cwiAvufca1SqXkcSfd5dsYvhAAZzGvxpSbhZ9KzTC3hA1hb/fknE2s+NJshMY7FFkWPu/SGW827eOzoUI2ZowaCoQpn8EWBZgOzjPINmPhGPXml6KuoZjBigTaM4YuBtA5RnbxYvQaXxNWFt/Tj2Dmyh3xYuyeLINBu6hH/s0v5k/uEYfEwu05PSRvUeFfbb+Gw+yJJRXysxRQKrsJJMEBJoUKtpJ+UjPj4YZ/5FKPGEhp/A+N2mzr6rdQUz6oDQEIVxV5UtpVsXaSKLhi0XjFwej6fy6JgkrluLrSzRX6pxmEC2l7dZBb6KmVW1GLXSfFlIMjVL4f/aiYtfXp+//lg0Svmf5G9zmsEcyZEPg3XD0j5TPApKujj1iX8mskr6G5JkJWISHGIayfLMO+N+n9J2FVnLMYjBWdazJ7yryzLDuNcuVXn8mNpZUXXvWdGTzEwPIozKw9iKt6njDY0NMlhEV7UpBzV8nRKV8GlBF5AytZe7FKJbRkwWvGamSCFzu6muyqsPEfI8khxZXPyflBzIIIcOOrCeJd3YpiSpfqtjRsv0pw+ObWoeoFkq0ZNhhqBlVHXmRVj+vjzsVEbQc53FkEv0PYMg7OX8qs962ShyhFoj9HiA7uw/HwzjalB9KLJF3hiy3zqMSJQl1xYxYi6MwnWHbOQ03dx+SSpakA=="
+
+func TestDecryptRefundReqInfo(t *testing.T) {
+	client := &WxClient{ApiKey: "192006250b4c09247ec02edce69f6a2d"}
+	reqInfo, err := client.DecryptRefundReqInfo(testRefundReqInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reqInfo.OutTradeNO != "T20201017001" || reqInfo.OutRefundNO != "R20201017001" ||
+		reqInfo.RefundStatus != "SUCCESS" || reqInfo.TotalFee != 200 || reqInfo.RefundFee != 100 ||
+		reqInfo.SuccessTime != "2020-10-17 12:30:45" {
+		t.Errorf("unexpected req_info: %+v", reqInfo)
+	}
+
+	client.ApiKey = "wrong key"
+	if _, err := client.DecryptRefundReqInfo(testRefundReqInfo); err == nil {
+		t.Error("expected error with wrong key")
+	}
+	if _, err := client.DecryptRefundReqInfo(""); err == nil {
+		t.Error("expected error with empty req_info")
+	}
+}
+
+func TestParseRefundNotifyBytes(t *testing.T) {
+	client := &WxClient{ApiKey: "192006250b4c09247ec02edce69f6a2d"}
+	body := "<xml><return_code>SUCCESS</return_code><appid><![CDATA[wx2421b1c4370ec43b]]></appid><mch_id><![CDATA[10000100]]></mch_id><nonce_str><![CDATA[TeqClE3i0mvn3DrK]]></nonce_str><req_info><![CDATA[" + testRefundReqInfo + "]]></req_info></xml>"
+	object, err := client.ParseRefundNotifyBytes([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.Status != OrderRefundSuccess || object.ThirdRefundFee != 100 || object.RefundTime.Format("2006-01-02 15:04:05") != "2020-10-17 12:30:45" {
+		t.Errorf("unexpected refund object: %+v", object)
+	}
+}
+
+// 按微信退款结果通知的方式加密req_info：md5(key)作为AES-256-ECB密钥，PKCS7填充后base64编码
+func encryptRefundReqInfo(t *testing.T, plain string, apiKey string) string {
+	keyMd5 := md5.Sum([]byte(apiKey))
+	block, err := aes.NewCipher([]byte(hex.EncodeToString(keyMd5[:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := block.BlockSize() - len(plain)%block.BlockSize()
+	data := append([]byte(plain), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	for start := 0; start < len(data); start += block.BlockSize() {
+		block.Encrypt(data[start:start+block.BlockSize()], data[start:start+block.BlockSize()])
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestParseRefundNotifyBytesUnknownStatus(t *testing.T) {
+	client := &WxClient{ApiKey: "192006250b4c09247ec02edce69f6a2d"}
+	reqInfo := encryptRefundReqInfo(t, "<root><out_trade_no>T20201017001</out_trade_no><out_refund_no>R20201017001</out_refund_no><refund_status>UNKNOWN</refund_status><total_fee>200</total_fee><refund_fee>100</refund_fee></root>", client.ApiKey)
+	body := "<xml><return_code>SUCCESS</return_code><req_info><![CDATA[" + reqInfo + "]]></req_info></xml>"
+	if _, err := client.ParseRefundNotifyBytes([]byte(body)); err == nil || err.Error() != "unknown refund_status: UNKNOWN" {
+		t.Errorf("err = %v, want unknown refund_status", err)
+	}
+}
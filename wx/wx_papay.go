@@ -0,0 +1,337 @@
+package wx
+
+import (
+	"encoding/xml"
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//===================================================================
+//					   委托代扣
+//	微信官方文档 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=17_1
+//
+//  签约：App、H5、公众号和小程序生成签约参数，用户签约后微信通知签约结果(contract_id)；
+//  扣款：ChargeParam.PayChannel为PAP时，Order使用ContractID申请扣款，扣款结果以通知或OrderQuery为准
+//===================================================================
+const (
+	PapayPreEntrustWebUrl  = "https://api.mch.weixin.qq.com/papay/preentrustweb"
+	PapayH5EntrustWebUrl   = "https://api.mch.weixin.qq.com/papay/h5entrustweb"
+	PapayEntrustWebUrl     = "https://api.mch.weixin.qq.com/papay/entrustweb"
+	PapayQueryContractUrl  = "https://api.mch.weixin.qq.com/papay/querycontract"
+	PapayDeleteContractUrl = "https://api.mch.weixin.qq.com/papay/deletecontract"
+	PapPayApplyUrl         = "https://api.mch.weixin.qq.com/pay/pappayapply"
+	PapOrderQueryUrl       = "https://api.mch.weixin.qq.com/pay/paporderquery"
+
+	papayVersion = "1.0" // 委托代扣签约接口版本号
+
+	ContractChangeTypeAdd    = "ADD"    // 签约
+	ContractChangeTypeDelete = "DELETE" // 解约
+
+	ContractStateSigned     = 0 // 协议状态，已签约
+	ContractStateTerminated = 1 // 协议状态，未生效或已解约
+)
+
+// PapayH5EntrustURL H5纯签约，用户在浏览器中打开返回的链接完成签约 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_16&index=4
+func (client *WxClient) PapayH5EntrustURL(param *PapayContractParam) string {
+	params := client.papayContractParams(param)
+	params["clientip"] = param.ClientIP // 【必传】用户客户端的真实IP
+	if IsNotEmpty(param.ReturnAppID) {
+		params["return_appid"] = param.ReturnAppID // 【非必传】签约完成后跳转回的应用appid
+	}
+	params["sign"] = client.signWithKey(params, SignTypeHmacSha256, client.ApiKey) // 【必传】签名，H5签约仅支持HMAC-SHA256
+
+	return PapayH5EntrustWebUrl + "?" + MapToUrlValues(params).Encode()
+}
+
+// PapayEntrustURL 公众号纯签约，在微信内打开返回的链接完成签约 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_1&index=1
+func (client *WxClient) PapayEntrustURL(param *PapayContractParam) string {
+	params := client.papayContractParams(param)
+	if param.ReturnWeb {
+		params["return_web"] = "1" // 【非必传】签约完成后返回商户页面
+	}
+	params["sign"] = client.signWithKey(params, SignTypeMd5, client.ApiKey) // 【必传】签名
+
+	return PapayEntrustWebUrl + "?" + MapToUrlValues(params).Encode()
+}
+
+// PapayMiniProgramExtraData 小程序纯签约，返回navigateToMiniProgram的extraData https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_17&index=5
+// notify_url由小程序传递给微信，不需要urlencode
+func (client *WxClient) PapayMiniProgramExtraData(param *PapayContractParam) map[string]string {
+	params := client.papayContractParams(param)
+	delete(params, "version")
+	params["sign"] = client.signWithKey(params, SignTypeMd5, client.ApiKey) // 【必传】签名
+	return params
+}
+
+// PapayPreEntrust App纯签约，返回预签约ID，App使用预签约ID调起签约 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_5&index=2
+func (client *WxClient) PapayPreEntrust(param *PapayContractParam) (string, error) {
+	if client.IsSandbox { // 委托代扣没有沙盒环境
+		return "", ErrSandboxNotSupported
+	}
+	params := client.papayContractParams(param)
+	if IsNotEmpty(param.ReturnAppID) {
+		params["return_app"] = "Y" // 【非必传】签约完成后返回App
+	}
+	params["sign"] = client.signWithKey(params, SignTypeMd5, client.ApiKey) // 【必传】签名
+
+	xmlStr, err := client.doPostWithXml(false, PapayPreEntrustWebUrl, params)
+	if err != nil {
+		return "", err
+	}
+
+	var respObject WxPapayPreEntrustResponse
+	err = xml.Unmarshal([]byte(xmlStr), &respObject)
+	if err != nil {
+		return "", err
+	}
+	if respObject.ReturnCode != Success { // 通信失败
+		return "", errors.New(respObject.ReturnMsg)
+	}
+	err = client.checkResponseSignWithType(xmlStr, SignTypeMd5)
+	if err != nil {
+		return "", err
+	}
+	if respObject.ResultCode != Success { // 预签约失败
+		return "", errors.New(respObject.ErrCodeDes)
+	}
+	return respObject.PreEntrustWebID, nil
+}
+
+// ParsePapayContractNotify 解析签约/解约结果通知 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_17&index=5
+func (client *WxClient) ParsePapayContractNotify(r *http.Request) (*WxPapayContract, error) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return client.ParsePapayContractNotifyBytes(body)
+}
+
+// ParsePapayContractNotifyBytes 解析签约/解约结果通知，body为微信POST的XML原文
+func (client *WxClient) ParsePapayContractNotifyBytes(body []byte) (*WxPapayContract, error) {
+	params, err := XmlToMap(string(body))
+	if err != nil {
+		return nil, err
+	}
+	if params["return_code"] != Success { // 通信失败
+		return nil, errors.New(params["return_msg"])
+	}
+
+	// H5签约使用HMAC-SHA256，其他签约方式使用MD5，通知中没有sign_type，两种签名类型均可
+	sign := params[Sign]
+	if sign != client.signWithKey(params, SignTypeMd5, client.ApiKey) &&
+		sign != client.signWithKey(params, SignTypeHmacSha256, client.ApiKey) {
+		return nil, ErrSignVerifyFail
+	}
+
+	var notify WxPapayContract
+	err = xml.Unmarshal(body, &notify)
+	if err != nil {
+		return nil, err
+	}
+	if notify.ResultCode != Success { // 签约/解约失败
+		return nil, errors.New(notify.ErrCodeDes)
+	}
+	return &notify, nil
+}
+
+// PapayQueryContract 查询签约关系 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_2&index=6
+func (client *WxClient) PapayQueryContract(param *PapayContractQueryParam) (*WxPapayContract, error) {
+	params := client.papayContractQueryParams(param)
+	return client.postPapayContract(PapayQueryContractUrl, params)
+}
+
+// PapayDeleteContract 申请解约 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_4&index=7
+func (client *WxClient) PapayDeleteContract(param *PapayContractQueryParam) (*WxPapayContract, error) {
+	params := client.papayContractQueryParams(param)
+	params["contract_termination_remark"] = param.ContractTerminationRemark // 【必传】解约原因
+	return client.postPapayContract(PapayDeleteContractUrl, params)
+}
+
+// PapPayApply 申请扣款 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_3&index=8
+// 扣款为异步处理，受理成功后返回OrderCreated，扣款结果以ParsePapayNotify或OrderQuery为准
+func (client *WxClient) PapPayApply(chargeParam *ChargeParam) (*ChargeObject, error) {
+	if client.IsSandbox { // 委托代扣没有沙盒环境
+		return nil, ErrSandboxNotSupported
+	}
+	params := make(map[string]string)
+	params["trade_type"] = PayChannelWxPap                            // 【必传】交易类型，委托代扣-PAP
+	params["out_trade_no"] = chargeParam.OrderID                      // 【必传】商户系统内部订单号
+	params["total_fee"] = strconv.FormatInt(chargeParam.TotalFee, 10) // 【必传】订单总金额，单位为分
+	params["body"] = chargeParam.Description                          // 【必传】商品描述
+	params["spbill_create_ip"] = chargeParam.ClientIP                 // 【必传】调用微信支付API的机器IP
+	params["notify_url"] = chargeParam.CallbackURL                    // 【必传】接收扣款结果通知的回调地址
+	params["contract_id"] = chargeParam.ContractID                    // 【必传】签约成功后微信返回的委托代扣协议id
+	_, err := client.appendSubMerchantParams(params, chargeParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+	params = client.appendBasicParams(params)
+
+	xmlStr, err := client.postWithXml(false, PapPayApplyUrl, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject ResponseBaseCode
+	err = xml.Unmarshal([]byte(xmlStr), &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ReturnCode != Success { // 通信失败
+		return nil, errors.New(respObject.ReturnMsg)
+	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != Success { // 扣款申请失败
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+
+	// ChargeObject
+	object := &ChargeObject{}
+	object.Status = OrderCreated // 1: 下单成功，等待扣款
+	object.ChargeParam = chargeParam
+	return object, nil
+}
+
+// PapOrderQuery 查询委托代扣订单 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_10&index=13
+func (client *WxClient) PapOrderQuery(orderQueryParam *OrderQueryParam) (*OrderQueryObject, error) {
+	if client.IsSandbox { // 委托代扣没有沙盒环境
+		return nil, ErrSandboxNotSupported
+	}
+	params := make(map[string]string)
+	params["out_trade_no"] = orderQueryParam.OrderID // 【必传】商户系统内部订单号
+	_, err := client.appendSubMerchantParams(params, orderQueryParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+	params = client.appendBasicParams(params)
+
+	xmlStr, err := client.postWithXml(false, PapOrderQueryUrl, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxPapOrderQueryResponse
+	err = xml.Unmarshal([]byte(xmlStr), &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ReturnCode != Success { // 通信失败
+		return nil, errors.New(respObject.ReturnMsg)
+	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != Success { // 查询失败
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+	params, err = XmlToMap(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	respObject.Coupons = parseCoupons(params, respObject.CouponCount)
+
+	// OrderQueryObject
+	object := &OrderQueryObject{
+		OrderID:         respObject.OutTradeNO,
+		Status:          mapTradeStateToStatus[respObject.TradeState],
+		PayTime:         GetWxPayTime(respObject.TimeEnd),
+		ThirdOrderID:    respObject.TransactionID,
+		ThirdOrderFee:   respObject.TotalFee,
+		Attach:          respObject.Attach,
+		OrderQueryParam: orderQueryParam,
+	}
+	fillOrderQueryFees(object, &respObject.ResponseResultCodeSuccess)
+	return object, nil
+}
+
+// ParsePapayNotify 解析委托代扣扣款结果通知 https://pay.weixin.qq.com/wiki/doc/api/pap.php?chapter=18_7&index=10
+func (client *WxClient) ParsePapayNotify(r *http.Request) (*WxPayNotify, error) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return client.ParsePapayNotifyBytes(body)
+}
+
+// ParsePapayNotifyBytes 解析委托代扣扣款结果通知，body为微信POST的XML原文
+// 扣款结果通知与支付结果通知格式相同，另外返回contract_id
+func (client *WxClient) ParsePapayNotifyBytes(body []byte) (*WxPayNotify, error) {
+	notify, err := client.ParseNotifyBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	if IsEmpty(notify.ContractID) {
+		return nil, errors.New("contract_id is NULL")
+	}
+	return notify, nil
+}
+
+// 签约公共参数
+func (client *WxClient) papayContractParams(param *PapayContractParam) map[string]string {
+	params := make(map[string]string)
+	params["appid"] = client.AppID                                        // 【必传】公众账号ID
+	params["mch_id"] = client.MchID                                       // 【必传】商户号
+	params["plan_id"] = param.PlanID                                      // 【必传】协议模板id
+	params["contract_code"] = param.ContractCode                          // 【必传】签约协议号
+	params["request_serial"] = strconv.FormatInt(param.RequestSerial, 10) // 【必传】请求序列号
+	params["contract_display_account"] = param.ContractDisplayAccount     // 【必传】用户账户展示名称
+	params["notify_url"] = param.NotifyURL                                // 【必传】签约/解约结果通知地址
+	params["version"] = papayVersion                                      // 【必传】版本号，固定值1.0
+	params["timestamp"] = strconv.FormatInt(time.Now().Unix(), 10)        // 【必传】时间戳，10位
+	return params
+}
+
+// 查询/解约公共参数
+func (client *WxClient) papayContractQueryParams(param *PapayContractQueryParam) map[string]string {
+	params := make(map[string]string)
+	params["appid"] = client.AppID  // 【必传】公众账号ID
+	params["mch_id"] = client.MchID // 【必传】商户号
+	params["version"] = papayVersion
+	if IsNotEmpty(param.ContractID) {
+		params["contract_id"] = param.ContractID // 【二选一】委托代扣协议id
+	} else {
+		params["plan_id"] = param.PlanID             // 【二选一】协议模板id
+		params["contract_code"] = param.ContractCode // 【二选一】签约协议号
+	}
+	return params
+}
+
+// 查询签约关系、解约请求，仅支持MD5签名
+func (client *WxClient) postPapayContract(requestUrl string, params map[string]string) (*WxPapayContract, error) {
+	if client.IsSandbox { // 委托代扣没有沙盒环境
+		return nil, ErrSandboxNotSupported
+	}
+	params["sign"] = client.signWithKey(params, SignTypeMd5, client.ApiKey)
+
+	xmlStr, err := client.doPostWithXml(false, requestUrl, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxPapayContract
+	err = xml.Unmarshal([]byte(xmlStr), &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ReturnCode != Success { // 通信失败
+		return nil, errors.New(respObject.ReturnMsg)
+	}
+	err = client.checkResponseSignWithType(xmlStr, SignTypeMd5)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != Success { // 业务失败
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+	return &respObject, nil
+}
@@ -0,0 +1,220 @@
+package wx
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+	"strconv"
+)
+
+//===================================================================
+//					   分账
+//	微信官方文档 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=26_1
+//
+//  下单时ChargeParam.ProfitSharing为true的订单，支付成功后可请求分账；
+//  分账接口仅支持HMAC-SHA256签名，并使用API证书
+//===================================================================
+const (
+	ProfitSharingAddReceiverUrl    = "https://api.mch.weixin.qq.com/pay/profitsharingaddreceiver"
+	ProfitSharingRemoveReceiverUrl = "https://api.mch.weixin.qq.com/pay/profitsharingremovereceiver"
+	ProfitSharingUrl               = "https://api.mch.weixin.qq.com/secapi/pay/profitsharing"
+	MultiProfitSharingUrl          = "https://api.mch.weixin.qq.com/secapi/pay/multiprofitsharing"
+	ProfitSharingQueryUrl          = "https://api.mch.weixin.qq.com/pay/profitsharingquery"
+	ProfitSharingFinishUrl         = "https://api.mch.weixin.qq.com/secapi/pay/profitsharingfinish"
+	ProfitSharingReturnUrl         = "https://api.mch.weixin.qq.com/secapi/pay/profitsharingreturn"
+	ProfitSharingReturnQueryUrl    = "https://api.mch.weixin.qq.com/pay/profitsharingreturnquery"
+
+	ProfitSharingReceiverMerchantID        = "MERCHANT_ID"         // 分账接收方类型，商户号
+	ProfitSharingReceiverPersonalOpenID    = "PERSONAL_OPENID"     // 分账接收方类型，个人openid
+	ProfitSharingReceiverPersonalSubOpenID = "PERSONAL_SUB_OPENID" // 分账接收方类型，个人sub_openid
+)
+
+// ProfitSharingAddReceiver 添加分账接收方 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=27_3&index=4
+func (client *WxClient) ProfitSharingAddReceiver(param *ProfitSharingReceiverParam) (*WxProfitSharingReceiverResponse, error) {
+	params := make(map[string]string)
+	params["receiver"] = Marshal(param.Receiver) // 【必传】分账接收方
+	_, err := client.appendSubMerchantParams(params, param.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxProfitSharingReceiverResponse
+	err = client.postProfitSharing(ProfitSharingAddReceiverUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+// ProfitSharingRemoveReceiver 删除分账接收方 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=27_4&index=5
+func (client *WxClient) ProfitSharingRemoveReceiver(param *ProfitSharingReceiverParam) (*WxProfitSharingReceiverResponse, error) {
+	params := make(map[string]string)
+	params["receiver"] = Marshal(&ProfitSharingReceiver{ // 【必传】分账接收方，只需要类型和帐号
+		Type:    param.Receiver.Type,
+		Account: param.Receiver.Account,
+	})
+	_, err := client.appendSubMerchantParams(params, param.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxProfitSharingReceiverResponse
+	err = client.postProfitSharing(ProfitSharingRemoveReceiverUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+// ProfitSharing 请求单次分账，分账后剩余资金自动解冻给商户 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=27_1&index=1
+func (client *WxClient) ProfitSharing(param *ProfitSharingParam) (*WxProfitSharingResponse, error) {
+	return client.profitSharing(ProfitSharingUrl, param)
+}
+
+// MultiProfitSharing 请求多次分账，需要调用ProfitSharingFinish完结分账 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=27_6&index=2
+func (client *WxClient) MultiProfitSharing(param *ProfitSharingParam) (*WxProfitSharingResponse, error) {
+	return client.profitSharing(MultiProfitSharingUrl, param)
+}
+
+// ProfitSharingQuery 查询分账结果 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=27_2&index=3
+func (client *WxClient) ProfitSharingQuery(param *ProfitSharingQueryParam) (*WxProfitSharingQueryResponse, error) {
+	params := make(map[string]string)
+	params["transaction_id"] = param.TransactionID // 【必传】微信订单号
+	params["out_order_no"] = param.OutOrderNO      // 【必传】商户分账单号
+	_, err := client.appendSubMerchantParams(params, param.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxProfitSharingQueryResponse
+	err = client.postProfitSharing(ProfitSharingQueryUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if IsNotEmpty(respObject.ReceiversJSON) {
+		err = json.Unmarshal([]byte(respObject.ReceiversJSON), &respObject.Receivers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &respObject, nil
+}
+
+// ProfitSharingFinish 完结分账，剩余待分账资金解冻给商户 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=27_5&index=6
+func (client *WxClient) ProfitSharingFinish(param *ProfitSharingFinishParam) (*WxProfitSharingResponse, error) {
+	params := make(map[string]string)
+	params["transaction_id"] = param.TransactionID // 【必传】微信订单号
+	params["out_order_no"] = param.OutOrderNO      // 【必传】商户分账单号
+	params["amount"] = "0"                         // 【必传】分账完结金额，固定为0
+	params["description"] = param.Description      // 【必传】分账完结描述
+	_, err := client.appendSubMerchantParams(params, param.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxProfitSharingResponse
+	err = client.postProfitSharing(ProfitSharingFinishUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+// ProfitSharingReturn 分账回退 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=27_7&index=7
+func (client *WxClient) ProfitSharingReturn(param *ProfitSharingReturnParam) (*WxProfitSharingReturnResponse, error) {
+	params := make(map[string]string)
+	if IsNotEmpty(param.OrderID) {
+		params["order_id"] = param.OrderID // 【二选一】微信分账单号
+	}
+	if IsNotEmpty(param.OutOrderNO) {
+		params["out_order_no"] = param.OutOrderNO // 【二选一】商户分账单号
+	}
+	params["out_return_no"] = param.OutReturnNO                         // 【必传】商户回退单号
+	params["return_account_type"] = param.ReturnAccountType             // 【必传】回退方类型
+	params["return_account"] = param.ReturnAccount                      // 【必传】回退方账号
+	params["return_amount"] = strconv.FormatInt(param.ReturnAmount, 10) // 【必传】回退金额，单位为分
+	params["description"] = param.Description                           // 【必传】回退描述
+	_, err := client.appendSubMerchantParams(params, param.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxProfitSharingReturnResponse
+	err = client.postProfitSharing(ProfitSharingReturnUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+// ProfitSharingReturnQuery 回退结果查询 https://pay.weixin.qq.com/wiki/doc/api/allocation.php?chapter=27_8&index=8
+func (client *WxClient) ProfitSharingReturnQuery(param *ProfitSharingReturnQueryParam) (*WxProfitSharingReturnResponse, error) {
+	params := make(map[string]string)
+	if IsNotEmpty(param.OrderID) {
+		params["order_id"] = param.OrderID // 【二选一】微信分账单号
+	}
+	if IsNotEmpty(param.OutOrderNO) {
+		params["out_order_no"] = param.OutOrderNO // 【二选一】商户分账单号
+	}
+	params["out_return_no"] = param.OutReturnNO // 【必传】商户回退单号
+	_, err := client.appendSubMerchantParams(params, param.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxProfitSharingReturnResponse
+	err = client.postProfitSharing(ProfitSharingReturnQueryUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+func (client *WxClient) profitSharing(requestUrl string, param *ProfitSharingParam) (*WxProfitSharingResponse, error) {
+	params := make(map[string]string)
+	params["transaction_id"] = param.TransactionID // 【必传】微信订单号
+	params["out_order_no"] = param.OutOrderNO      // 【必传】商户分账单号
+	params["receivers"] = Marshal(param.Receivers) // 【必传】分账接收方列表
+	_, err := client.appendSubMerchantParams(params, param.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxProfitSharingResponse
+	err = client.postProfitSharing(requestUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	return &respObject, nil
+}
+
+// 分账请求，使用HMAC-SHA256签名和API证书，校验响应签名
+func (client *WxClient) postProfitSharing(requestUrl string, params map[string]string, respObject interface{}) error {
+	if client.IsSandbox { // 分账接口没有沙盒环境
+		return ErrSandboxNotSupported
+	}
+	params = client.appendBasicParamsWithSignType(params, SignTypeHmacSha256)
+
+	xmlStr, err := client.postWithXml(true, requestUrl, params)
+	if err != nil {
+		return err
+	}
+
+	var baseCode ResponseBaseCode
+	err = xml.Unmarshal([]byte(xmlStr), &baseCode)
+	if err != nil {
+		return err
+	}
+	if baseCode.ReturnCode != Success { // 通信失败
+		return errors.New(baseCode.ReturnMsg)
+	}
+	err = client.checkResponseSignWithType(xmlStr, SignTypeHmacSha256)
+	if err != nil {
+		return err
+	}
+	if baseCode.ResultCode != Success { // 业务失败
+		return errors.New(baseCode.ErrCodeDes)
+	}
+	return xml.Unmarshal([]byte(xmlStr), respObject)
+}
@@ -0,0 +1,124 @@
+package wx
+
+import (
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+	"strconv"
+)
+
+//===================================================================
+//					   现金红包
+//	微信官方文档 https://pay.weixin.qq.com/wiki/doc/api/tools/cash_coupon.php?chapter=13_1
+//
+//  现金红包接口仅支持MD5签名，并使用API证书；没有沙盒环境。
+//  同一个mch_billno重复请求视为同一个红包，接口返回SYSTEMERROR或请求失败时，
+//  会使用原mch_billno查询红包记录，仍查询不到时返回ErrRedPackUnknown，调用方应使用原单号重试
+//===================================================================
+const (
+	SendRedPackUrl      = "https://api.mch.weixin.qq.com/mmpaymkttransfers/sendredpack"
+	SendGroupRedPackUrl = "https://api.mch.weixin.qq.com/mmpaymkttransfers/sendgroupredpack"
+	GetRedPackInfoUrl   = "https://api.mch.weixin.qq.com/mmpaymkttransfers/gethbinfo"
+
+	RedPackStatusSending   = "SENDING"   // 红包状态，发放中
+	RedPackStatusSent      = "SENT"      // 红包状态，已发放待领取
+	RedPackStatusFailed    = "FAILED"    // 红包状态，发放失败
+	RedPackStatusReceived  = "RECEIVED"  // 红包状态，已领取
+	RedPackStatusRefunding = "RFUND_ING" // 红包状态，退款中
+	RedPackStatusRefund    = "REFUND"    // 红包状态，已退款
+
+	RedPackTypeNormal = "NORMAL" // 红包类型，普通红包
+	RedPackTypeGroup  = "GROUP"  // 红包类型，裂变红包
+)
+
+var (
+	ErrRedPackUnknown = errors.New("wx redpack result unknown, retry with the same mch_billno") // 红包发放结果未知
+)
+
+// SendRedPack 发放普通红包 https://pay.weixin.qq.com/wiki/doc/api/tools/cash_coupon.php?chapter=13_4&index=3
+func (client *WxClient) SendRedPack(redPackParam *RedPackParam) (*WxRedPackResponse, error) {
+	params := client.redPackParams(redPackParam)
+	params["total_num"] = "1"                   // 【必传】红包发放总人数，普通红包固定为1
+	params["client_ip"] = redPackParam.ClientIP // 【必传】调用接口的机器IP地址
+	return client.sendRedPack(SendRedPackUrl, redPackParam.MchBillNO, params)
+}
+
+// SendGroupRedPack 发放裂变红包 https://pay.weixin.qq.com/wiki/doc/api/tools/cash_coupon.php?chapter=13_5&index=4
+func (client *WxClient) SendGroupRedPack(redPackParam *RedPackParam) (*WxRedPackResponse, error) {
+	params := client.redPackParams(redPackParam)
+	params["total_num"] = strconv.FormatInt(redPackParam.TotalNum, 10) // 【必传】红包发放总人数，不小于3
+	params["amt_type"] = "ALL_RAND"                                    // 【必传】红包金额设置方式，全部随机
+	return client.sendRedPack(SendGroupRedPackUrl, redPackParam.MchBillNO, params)
+}
+
+// GetRedPackInfo 查询红包记录 https://pay.weixin.qq.com/wiki/doc/api/tools/cash_coupon.php?chapter=13_6&index=5
+func (client *WxClient) GetRedPackInfo(mchBillNO string) (*WxRedPackInfoResponse, error) {
+	params := make(map[string]string)
+	params["mch_billno"] = mchBillNO // 【必传】商户订单号
+	params["mch_id"] = client.MchID  // 【必传】微信支付分配的商户号
+	params["appid"] = client.AppID   // 【必传】公众账号appid
+	params["bill_type"] = "MCHT"     // 【必传】订单类型，通过商户订单号获取红包信息
+
+	var respObject WxRedPackInfoResponse
+	err := client.postWithMd5Cert(GetRedPackInfoUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != Success {
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+	return &respObject, nil
+}
+
+// 普通红包和裂变红包的公共参数
+func (client *WxClient) redPackParams(redPackParam *RedPackParam) map[string]string {
+	params := make(map[string]string)
+	params["mch_billno"] = redPackParam.MchBillNO                            // 【必传】商户订单号
+	params["mch_id"] = client.MchID                                          // 【必传】微信支付分配的商户号
+	params["wxappid"] = client.AppID                                         // 【必传】公众账号appid
+	params["send_name"] = redPackParam.SendName                              // 【必传】商户名称
+	params["re_openid"] = redPackParam.ReOpenID                              // 【必传】接收红包的用户openid
+	params["total_amount"] = strconv.FormatInt(redPackParam.TotalAmount, 10) // 【必传】付款金额，单位为分
+	params["wishing"] = redPackParam.Wishing                                 // 【必传】红包祝福语
+	params["act_name"] = redPackParam.ActName                                // 【必传】活动名称
+	params["remark"] = redPackParam.Remark                                   // 【必传】备注信息
+	if IsNotEmpty(redPackParam.SceneID) {
+		params["scene_id"] = redPackParam.SceneID // 【非必传】场景id
+	}
+	if IsNotEmpty(redPackParam.RiskInfo) {
+		params["risk_info"] = redPackParam.RiskInfo // 【非必传】活动信息
+	}
+	return params
+}
+
+func (client *WxClient) sendRedPack(requestUrl string, mchBillNO string, params map[string]string) (*WxRedPackResponse, error) {
+	var respObject WxRedPackResponse
+	err := client.postWithMd5Cert(requestUrl, params, &respObject)
+	if err == nil && respObject.ResultCode == Success {
+		return &respObject, nil
+	}
+	if err == ErrSandboxNotSupported {
+		return nil, err
+	}
+	if err == nil && respObject.ErrCode != transferErrCodeSystemError { // 发放失败
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+
+	// 发放结果未知，使用原商户订单号查询红包记录
+	infoObject, err := client.GetRedPackInfo(mchBillNO)
+	if err != nil {
+		return nil, ErrRedPackUnknown
+	}
+	if infoObject.Status == RedPackStatusFailed {
+		return nil, errors.New(infoObject.Reason)
+	}
+	respObject.ResultCode = Success
+	respObject.ErrCode = ""
+	respObject.ErrCodeDes = ""
+	respObject.MchBillNO = infoObject.MchBillNO
+	respObject.MchID = infoObject.MchID
+	respObject.WxAppID = client.AppID
+	respObject.ReOpenID = params["re_openid"]
+	respObject.TotalAmount = infoObject.TotalAmount
+	respObject.SendListID = infoObject.DetailID
+	return &respObject, nil
+}
@@ -0,0 +1,111 @@
+package wx
+
+import (
+	"encoding/xml"
+	. "github.com/bmbstack/gopay/common"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//===================================================================
+//					   交易保障
+//	微信官方文档 https://pay.weixin.qq.com/wiki/doc/api/micropay.php?chapter=9_14&index=8
+//
+//  商户调用微信支付接口后，上报接口耗时和返回结果，微信要求付款码支付必须上报；
+//  上报异步进行，失败时忽略，不影响接口调用结果
+//===================================================================
+const (
+	ReportLevelMicroPay = 0  // 默认，只上报付款码支付流程中的下单、查询和撤销
+	ReportLevelAll      = 1  // 上报所有接口
+	ReportLevelNone     = -1 // 不上报
+
+	reportTimeout = 3 * time.Second // 上报请求超时时间，避免上报协程长时间阻塞
+)
+
+// 默认上报的接口
+var microPayReportUrls = map[string]bool{
+	MicroPayUrl:        true,
+	SandboxMicroPayUrl: true,
+	ReverseUrl:         true,
+	SandboxReverseUrl:  true,
+}
+
+// 是否上报接口调用结果，microPay为true表示付款码支付流程中的调用，如轮询查询订单
+func (client *WxClient) needReport(url string, microPay bool) bool {
+	switch client.ReportLevel {
+	case ReportLevelAll:
+		return true
+	case ReportLevelNone:
+		return false
+	default:
+		return microPay || microPayReportUrls[url]
+	}
+}
+
+// 交易保障上报，err为请求失败时的错误
+func (client *WxClient) report(interfaceUrl string, outTradeNO string, clientIP string, xmlStr string, err error, startTime time.Time) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxReportUrl
+	} else {
+		requestUrl = ReportUrl
+	}
+
+	var respObject ResponseBaseCode
+	if err != nil {
+		respObject.ReturnCode = Fail
+		respObject.ReturnMsg = err.Error()
+	} else if xml.Unmarshal([]byte(xmlStr), &respObject) != nil {
+		respObject.ReturnCode = Fail
+	}
+
+	userIP := client.ServerIP
+	if IsEmpty(userIP) {
+		userIP = clientIP
+	}
+	if IsEmpty(userIP) {
+		userIP = localIP()
+	}
+	if IsEmpty(userIP) { // user_ip必传，取不到机器IP时不上报
+		return
+	}
+
+	params := make(map[string]string)
+	params["interface_url"] = interfaceUrl                                                         // 【必传】上报对应的接口的完整URL
+	params["execute_time_"] = strconv.FormatInt(int64(time.Since(startTime)/time.Millisecond), 10) // 【必传】接口耗时，单位为毫秒
+	params["return_code"] = respObject.ReturnCode                                                  // 【必传】返回状态码
+	params["return_msg"] = respObject.ReturnMsg                                                    // 【非必传】返回信息
+	params["result_code"] = respObject.ResultCode                                                  // 【必传】业务结果
+	params["err_code"] = respObject.ErrCode                                                        // 【非必传】错误代码
+	params["err_code_des"] = respObject.ErrCodeDes                                                 // 【非必传】错误代码描述
+	params["out_trade_no"] = outTradeNO                                                            // 【非必传】商户订单号
+	params["user_ip"] = userIP                                                                     // 【必传】发起接口调用时的机器IP
+	params["time"] = FormatPayTime(startTime, DateFullLayoutWithoutSplit)                          // 【非必传】商户上报时间
+	if IsEmpty(params["result_code"]) {
+		params["result_code"] = Fail
+	}
+	params = client.appendBasicParams(params)
+
+	hc := &http.Client{Timeout: reportTimeout}
+	resp, err := client.postWithClient(hc, requestUrl, params)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// 本机第一个非回环的IPv4地址，撤销订单、查询订单等请求中没有终端IP时使用
+func localIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+	}
+	return ""
+}
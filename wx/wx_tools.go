@@ -0,0 +1,87 @@
+package wx
+
+import (
+	"encoding/xml"
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+)
+
+// ShortURL 转换短链接，如NATIVE支付的CodeURL转换成短链接后生成二维码，提高扫码速度 https://pay.weixin.qq.com/wiki/doc/api/native.php?chapter=9_9&index=10
+func (client *WxClient) ShortURL(longURL string) (string, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxShortUrl
+	} else {
+		requestUrl = ShortUrl
+	}
+
+	params := make(map[string]string)
+	params["long_url"] = longURL                                    // 【必传】需要转换的URL
+	_, err := client.appendSubMerchantParams(params, SubMerchant{}) // 使用WxClient上配置的子商户
+	if err != nil {
+		return "", err
+	}
+	params = client.appendBasicParams(params)
+
+	xmlStr, err := client.postWithXml(false, requestUrl, params)
+	if err != nil {
+		return "", err
+	}
+
+	var respObject WxShortURLResponse
+	err = xml.Unmarshal([]byte(xmlStr), &respObject)
+	if err != nil {
+		return "", err
+	}
+	if respObject.ReturnCode != Success { // 通信失败
+		return "", errors.New(respObject.ReturnMsg)
+	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return "", err
+	}
+	if respObject.ResultCode != Success { // 转换失败
+		return "", errors.New(respObject.ErrCodeDes)
+	}
+	return respObject.ShortURL, nil
+}
+
+// AuthCodeToOpenID 付款码查询openid，用于付款码支付前识别用户 https://pay.weixin.qq.com/wiki/doc/api/micropay.php?chapter=9_13&index=9
+func (client *WxClient) AuthCodeToOpenID(authCode string) (*WxAuthCodeToOpenIDResponse, error) {
+	var requestUrl string
+	if client.IsSandbox {
+		requestUrl = SandboxAuthCodeToOpenidUrl
+	} else {
+		requestUrl = AuthCodeToOpenidUrl
+	}
+
+	params := make(map[string]string)
+	params["auth_code"] = authCode                                  // 【必传】扫码设备读取用户微信中的条码或者二维码信息
+	_, err := client.appendSubMerchantParams(params, SubMerchant{}) // 使用WxClient上配置的子商户
+	if err != nil {
+		return nil, err
+	}
+	params = client.appendBasicParams(params)
+
+	xmlStr, err := client.postWithXml(false, requestUrl, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxAuthCodeToOpenIDResponse
+	err = xml.Unmarshal([]byte(xmlStr), &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ReturnCode != Success { // 通信失败
+		return nil, errors.New(respObject.ReturnMsg)
+	}
+	err = client.checkResponseSign(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != Success { // 查询失败
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+	return &respObject, nil
+}
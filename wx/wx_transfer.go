@@ -0,0 +1,265 @@
+package wx
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	. "github.com/bmbstack/gopay/common"
+	"strconv"
+)
+
+//===================================================================
+//					   企业付款
+//	付款到零钱 https://pay.weixin.qq.com/wiki/doc/api/tools/mch_pay.php?chapter=14_2
+//	付款到银行卡 https://pay.weixin.qq.com/wiki/doc/api/tools/mch_pay.php?chapter=24_2
+//
+//  企业付款接口仅支持MD5签名，并使用API证书；没有沙盒环境。
+//  同一个partner_trade_no重复请求视为同一笔付款，接口返回SYSTEMERROR或请求失败时，
+//  会使用原partner_trade_no查询付款结果，结果仍未知时返回ErrTransferUnknown，调用方应使用原单号重试
+//===================================================================
+const (
+	TransferUrl          = "https://api.mch.weixin.qq.com/mmpaymkttransfers/promotion/transfers"
+	TransferQueryUrl     = "https://api.mch.weixin.qq.com/mmpaymkttransfers/gettransferinfo"
+	TransferBankUrl      = "https://api.mch.weixin.qq.com/mmpaysptrans/pay_bank"
+	TransferBankQueryUrl = "https://api.mch.weixin.qq.com/mmpaysptrans/query_bank"
+	GetPublicKeyUrl      = "https://fraud.mch.weixin.qq.com/risk/getpublickey"
+
+	TransferStatusSuccess    = "SUCCESS"    // 付款状态，转账成功
+	TransferStatusFailed     = "FAILED"     // 付款状态，转账失败
+	TransferStatusProcessing = "PROCESSING" // 付款状态，处理中
+	TransferStatusBankFail   = "BANK_FAIL"  // 付款状态，银行退票
+
+	transferErrCodeSystemError = "SYSTEMERROR" // 系统繁忙，付款结果未知
+)
+
+var (
+	ErrTransferUnknown = errors.New("wx transfer result unknown, retry with the same partner_trade_no") // 付款结果未知
+)
+
+// Transfer 付款到零钱 https://pay.weixin.qq.com/wiki/doc/api/tools/mch_pay.php?chapter=14_2
+func (client *WxClient) Transfer(transferParam *TransferParam) (*WxTransferResponse, error) {
+	params := make(map[string]string)
+	params["mch_appid"] = client.AppID                             // 【必传】商户账号appid
+	params["mchid"] = client.MchID                                 // 【必传】微信支付分配的商户号
+	params["partner_trade_no"] = transferParam.PartnerTradeNO      // 【必传】商户订单号
+	params["openid"] = transferParam.OpenID                        // 【必传】用户openid
+	params["amount"] = strconv.FormatInt(transferParam.Amount, 10) // 【必传】付款金额，单位为分
+	params["desc"] = transferParam.Desc                            // 【必传】付款备注
+	params["spbill_create_ip"] = transferParam.ClientIP            // 【必传】调用接口的机器IP地址
+	if IsNotEmpty(transferParam.ReUserName) {
+		params["check_name"] = "FORCE_CHECK"              // 【必传】校验用户姓名选项 NO_CHECK/FORCE_CHECK
+		params["re_user_name"] = transferParam.ReUserName // 【非必传】收款用户姓名
+	} else {
+		params["check_name"] = "NO_CHECK"
+	}
+	if IsNotEmpty(transferParam.DeviceInfo) {
+		params["device_info"] = transferParam.DeviceInfo // 【非必传】设备号
+	}
+
+	var respObject WxTransferResponse
+	err := client.postWithMd5Cert(TransferUrl, params, &respObject)
+	if err == nil && respObject.ResultCode == Success {
+		return &respObject, nil
+	}
+	if err == ErrSandboxNotSupported {
+		return nil, err
+	}
+	if err == nil && respObject.ErrCode != transferErrCodeSystemError { // 付款失败
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+
+	// 付款结果未知，使用原商户订单号查询
+	queryObject, err := client.TransferQuery(transferParam.PartnerTradeNO)
+	if err != nil {
+		return nil, ErrTransferUnknown
+	}
+	switch queryObject.Status {
+	case TransferStatusSuccess:
+		respObject.ResultCode = Success
+		respObject.ErrCode = ""
+		respObject.ErrCodeDes = ""
+		respObject.MchAppID = queryObject.AppID
+		respObject.MchID = queryObject.MchID
+		respObject.PartnerTradeNO = queryObject.PartnerTradeNO
+		respObject.PaymentNO = queryObject.DetailID
+		respObject.PaymentTime = queryObject.PaymentTime
+		return &respObject, nil
+	case TransferStatusFailed:
+		return nil, errors.New(queryObject.Reason)
+	}
+	return nil, ErrTransferUnknown
+}
+
+// TransferQuery 查询付款到零钱 https://pay.weixin.qq.com/wiki/doc/api/tools/mch_pay.php?chapter=14_3
+func (client *WxClient) TransferQuery(partnerTradeNO string) (*WxTransferQueryResponse, error) {
+	params := make(map[string]string)
+	params["appid"] = client.AppID              // 【必传】商户号的appid
+	params["mch_id"] = client.MchID             // 【必传】微信支付分配的商户号
+	params["partner_trade_no"] = partnerTradeNO // 【必传】商户订单号
+
+	var respObject WxTransferQueryResponse
+	err := client.postWithMd5Cert(TransferQueryUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != Success {
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+	return &respObject, nil
+}
+
+// TransferBank 付款到银行卡 https://pay.weixin.qq.com/wiki/doc/api/tools/mch_pay.php?chapter=24_2
+// 银行卡付款为异步处理，返回成功表示微信已受理，付款结果通过TransferBankQuery查询
+func (client *WxClient) TransferBank(transferBankParam *TransferBankParam) (*WxTransferBankResponse, error) {
+	encBankNO, err := client.rsaEncrypt(transferBankParam.BankNO)
+	if err != nil {
+		return nil, err
+	}
+	encTrueName, err := client.rsaEncrypt(transferBankParam.TrueName)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string)
+	params["mch_id"] = client.MchID                                    // 【必传】微信支付分配的商户号
+	params["partner_trade_no"] = transferBankParam.PartnerTradeNO      // 【必传】商户付款单号
+	params["enc_bank_no"] = encBankNO                                  // 【必传】收款方银行卡号，RSA加密
+	params["enc_true_name"] = encTrueName                              // 【必传】收款方用户名，RSA加密
+	params["bank_code"] = transferBankParam.BankCode                   // 【必传】收款方开户行
+	params["amount"] = strconv.FormatInt(transferBankParam.Amount, 10) // 【必传】付款金额，单位为分
+	if IsNotEmpty(transferBankParam.Desc) {
+		params["desc"] = transferBankParam.Desc // 【非必传】付款说明
+	}
+
+	var respObject WxTransferBankResponse
+	err = client.postWithMd5Cert(TransferBankUrl, params, &respObject)
+	if err == nil && respObject.ResultCode == Success {
+		return &respObject, nil
+	}
+	if err == ErrSandboxNotSupported {
+		return nil, err
+	}
+	if err == nil && respObject.ErrCode != transferErrCodeSystemError { // 付款失败
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+
+	// 付款结果未知，使用原商户付款单号查询，查询到付款单即表示已受理
+	queryObject, err := client.TransferBankQuery(transferBankParam.PartnerTradeNO)
+	if err != nil {
+		return nil, ErrTransferUnknown
+	}
+	switch queryObject.Status {
+	case TransferStatusFailed, TransferStatusBankFail:
+		return nil, errors.New(queryObject.Reason)
+	}
+	respObject.ResultCode = Success
+	respObject.ErrCode = ""
+	respObject.ErrCodeDes = ""
+	respObject.MchID = queryObject.MchID
+	respObject.PartnerTradeNO = queryObject.PartnerTradeNO
+	respObject.Amount = queryObject.Amount
+	respObject.PaymentNO = queryObject.PaymentNO
+	respObject.CmmsAmt = queryObject.CmmsAmt
+	return &respObject, nil
+}
+
+// TransferBankQuery 查询付款到银行卡 https://pay.weixin.qq.com/wiki/doc/api/tools/mch_pay.php?chapter=24_3
+func (client *WxClient) TransferBankQuery(partnerTradeNO string) (*WxTransferBankQueryResponse, error) {
+	params := make(map[string]string)
+	params["mch_id"] = client.MchID             // 【必传】微信支付分配的商户号
+	params["partner_trade_no"] = partnerTradeNO // 【必传】商户付款单号
+
+	var respObject WxTransferBankQueryResponse
+	err := client.postWithMd5Cert(TransferBankQueryUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != Success {
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+	return &respObject, nil
+}
+
+// 使用MD5签名和API证书请求营销类接口(企业付款等)，只校验通信结果，业务结果由调用方处理
+// 这些接口没有沙盒环境，IsSandbox时直接返回ErrSandboxNotSupported
+func (client *WxClient) postWithMd5Cert(requestUrl string, params map[string]string, respObject interface{}) error {
+	if client.IsSandbox {
+		return ErrSandboxNotSupported
+	}
+	params["nonce_str"] = NonceStr() // 【必传】随机字符串，不长于32位
+	params["sign"] = client.signWithKey(params, SignTypeMd5, client.ApiKey)
+
+	xmlStr, err := client.doPostWithXml(true, requestUrl, params)
+	if err != nil {
+		return err
+	}
+
+	var returnCode ResponseReturnCode
+	err = xml.Unmarshal([]byte(xmlStr), &returnCode)
+	if err != nil {
+		return err
+	}
+	if returnCode.ReturnCode != Success { // 通信失败
+		return errors.New(returnCode.ReturnMsg)
+	}
+	return xml.Unmarshal([]byte(xmlStr), respObject)
+}
+
+// 使用付款到银行卡RSA公钥加密，RSA/ECB/OAEPWITHSHA-1ANDMGF1PADDING
+func (client *WxClient) rsaEncrypt(value string) (string, error) {
+	publicKey, err := client.getBankPublicKey()
+	if err != nil {
+		return "", err
+	}
+	cipherBytes, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, publicKey, []byte(value), nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(cipherBytes), nil
+}
+
+// 获取付款到银行卡RSA公钥 https://pay.weixin.qq.com/wiki/doc/api/tools/mch_pay.php?chapter=24_7
+// 公钥获取后缓存在WxClient上，商户更换API证书后需重新创建WxClient
+func (client *WxClient) getBankPublicKey() (*rsa.PublicKey, error) {
+	client.bankPublicKeyMu.Lock()
+	defer client.bankPublicKeyMu.Unlock()
+
+	if client.bankPublicKey != nil {
+		return client.bankPublicKey, nil
+	}
+
+	params := make(map[string]string)
+	params["mch_id"] = client.MchID   // 【必传】微信支付分配的商户号
+	params["sign_type"] = SignTypeMd5 // 【必传】签名类型，仅支持MD5
+
+	var respObject WxGetPublicKeyResponse
+	err := client.postWithMd5Cert(GetPublicKeyUrl, params, &respObject)
+	if err != nil {
+		return nil, err
+	}
+	if respObject.ResultCode != Success {
+		return nil, errors.New(respObject.ErrCodeDes)
+	}
+
+	block, _ := pem.Decode([]byte(respObject.PubKey))
+	if block == nil {
+		return nil, errors.New("bank public key block error")
+	}
+	if publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		client.bankPublicKey = publicKey
+	} else if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("bank public key is not rsa key")
+		}
+		client.bankPublicKey = publicKey
+	} else {
+		return nil, errors.New("bank public key is incorrect")
+	}
+	return client.bankPublicKey, nil
+}
@@ -0,0 +1,678 @@
+package wx
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	. "github.com/bmbstack/gopay/common"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var v3Clients map[string]*WxV3Client
+
+func init() {
+	v3Clients = make(map[string]*WxV3Client)
+}
+
+//===================================================================
+//					   WxV3Client
+//	微信支付APIv3官方文档 https://pay.weixin.qq.com/wiki/doc/apiv3/index.shtml
+//
+//  请求：商户使用商户API私钥进行签名，放在Authorization头中
+//  响应：微信支付使用平台私钥进行签名，商户使用平台证书验证Wechatpay-Signature
+//===================================================================
+type WxV3Client struct {
+	AppID           string // 应用ID
+	MchID           string // 商户号
+	ApiV3Key        string // APIv3密钥，用于解密平台证书和回调报文
+	MchPrivateKey   []byte // 商户API私钥(apiclient_key.pem)
+	MchCertSerialNo string // 商户API证书序列号
+	PlatformCert    []byte // 【非必传】平台证书或平台公钥(PEM)，设置后用于验证下载的平台证书列表，未设置时只能用下载的证书自验
+
+	keyMu                 sync.Mutex
+	privateKey            *rsa.PrivateKey // 解析后的商户API私钥
+	platformPublicKey     *rsa.PublicKey  // 解析后的PlatformCert
+	certMu                sync.Mutex
+	platformCerts         map[string]*x509.Certificate // 平台证书，key为证书序列号
+	platformCertsExpireAt time.Time                    // 平台证书缓存过期时间
+}
+
+func AddWxV3Client(key string, client *WxV3Client) {
+	v3Clients[key] = client
+}
+
+func GetWxV3Client(key string) *WxV3Client {
+	value, ok := v3Clients[key]
+	if !ok {
+		panic("This WxV3Client not found")
+	}
+	return value
+}
+
+// Order 下单 https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter3_2_1.shtml
+func (client *WxV3Client) Order(chargeParam *ChargeParam) (*ChargeObject, error) {
+	err := checkV3SubMerchant(chargeParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+	if IsNotEmpty(chargeParam.SubOpenID) {
+		return nil, errors.New("wx v3 not support subOpenID")
+	}
+
+	var path string
+	switch strings.ToUpper(chargeParam.PayChannel) {
+	case PayChannelWxApp:
+		path = V3TransactionsAppPath
+	case PayChannelWxJsapi:
+		path = V3TransactionsJsapiPath
+	case PayChannelWxNative:
+		path = V3TransactionsNativePath
+	case PayChannelWxH5:
+		path = V3TransactionsH5Path
+	default:
+		return nil, errors.New(fmt.Sprintf("wx v3 not support pay channel: %s", chargeParam.PayChannel))
+	}
+
+	body := map[string]interface{}{
+		"appid":        client.AppID,            // 【必传】应用ID
+		"mchid":        client.MchID,            // 【必传】直连商户号
+		"description":  chargeParam.Description, // 【必传】商品描述
+		"out_trade_no": chargeParam.OrderID,     // 【必传】商户系统内部订单号，只能是数字、大小写字母_-*且在同一个商户号下唯一
+		"notify_url":   chargeParam.CallbackURL, // 【必传】异步接收微信支付结果通知的回调地址
+		"amount": map[string]interface{}{ // 【必传】订单金额
+			"total":    chargeParam.TotalFee, // 订单总金额，单位为分
+			"currency": V3Currency,           // CNY：人民币
+		},
+	}
+	sceneInfo := map[string]interface{}{
+		"payer_client_ip": chargeParam.ClientIP, // 用户终端IP
+	}
+	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxH5) {
+		// 【H5必传】场景类型 iOS, Android, Wap
+		h5Type := "Wap"
+		if chargeParam.SceneInfo == "iOS" || chargeParam.SceneInfo == "Android" {
+			h5Type = chargeParam.SceneInfo
+		}
+		sceneInfo["h5_info"] = map[string]string{"type": h5Type}
+	}
+	body["scene_info"] = sceneInfo
+	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxJsapi) {
+		openID := chargeParam.OpenID
+		if IsEmpty(openID) {
+			openID = chargeParam.PayerID
+		}
+		body["payer"] = map[string]string{"openid": openID} // 【JSAPI必传】OpenID
+	}
+	if chargeParam.NoCredit {
+		return nil, errors.New("wx v3 not support noCredit")
+	}
+	if chargeParam.ExpireTime != nil {
+		if chargeParam.ExpireTime.Sub(time.Now()) < orderMinExpire {
+			return nil, errors.New(fmt.Sprintf("wx time_expire must be at least %s after time_start", orderMinExpire))
+		}
+		body["time_expire"] = chargeParam.ExpireTime.Format(time.RFC3339) // 【非必传】订单失效时间，RFC3339格式
+	}
+	if IsNotEmpty(chargeParam.Attach) {
+		body["attach"] = chargeParam.Attach // 【非必传】附加数据，在查询API和支付通知中原样返回
+	}
+	if IsNotEmpty(chargeParam.GoodsTag) {
+		body["goods_tag"] = chargeParam.GoodsTag // 【非必传】订单优惠标记
+	}
+	if chargeParam.Receipt {
+		body["support_fapiao"] = true // 【非必传】电子发票入口开放标识
+	}
+	if chargeParam.OrderDetail != nil {
+		err = checkOrderDetail(chargeParam.OrderDetail, chargeParam.TotalFee)
+		if err != nil {
+			return nil, err
+		}
+		body["detail"] = toV3Detail(chargeParam.OrderDetail) // 【非必传】优惠功能，单品优惠使用
+	}
+
+	var respObject WxV3OrderResponse
+	err = client.doRequest(http.MethodPost, path, body, &respObject)
+	if err != nil {
+		return nil, err
+	}
+
+	// ChargeObject
+	object := &ChargeObject{}
+	object.Status = OrderCreated // 1: 下单成功
+	object.PrepayID = respObject.PrepayID
+	object.CodeURL = respObject.CodeURL
+	object.MWebURL = respObject.H5URL
+	object.ChargeParam = chargeParam
+
+	wxPayParam := make(map[string]string)
+	if strings.EqualFold(chargeParam.PayChannel, PayChannelWxJsapi) {
+		wxPayParam = map[string]string{
+			"appId":     client.AppID,
+			"timeStamp": strconv.FormatInt(time.Now().Unix(), 10),
+			"nonceStr":  NonceStr(),
+			"package":   fmt.Sprintf("prepay_id=%s", respObject.PrepayID),
+			"signType":  V3SignTypeRSA,
+		}
+		wxPayParam["paySign"], err = client.sign(wxPayParam["appId"], wxPayParam["timeStamp"], wxPayParam["nonceStr"], wxPayParam["package"])
+	} else if strings.EqualFold(chargeParam.PayChannel, PayChannelWxApp) {
+		wxPayParam = map[string]string{
+			"appid":     client.AppID,
+			"partnerid": client.MchID,
+			"prepayid":  respObject.PrepayID,
+			"package":   "Sign=WXPay",
+			"noncestr":  NonceStr(),
+			"timestamp": strconv.FormatInt(time.Now().Unix(), 10),
+		}
+		wxPayParam["sign"], err = client.sign(wxPayParam["appid"], wxPayParam["timestamp"], wxPayParam["noncestr"], wxPayParam["prepayid"])
+	} else {
+		// nothing
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	object.PayParam = Marshal(wxPayParam)
+	return object, nil
+}
+
+// OrderQuery 订单查询 https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter3_2_2.shtml
+func (client *WxV3Client) OrderQuery(orderQueryParam *OrderQueryParam) (*OrderQueryObject, error) {
+	err := checkV3SubMerchant(orderQueryParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf(V3OrderQueryPath, url.PathEscape(orderQueryParam.OrderID)) + "?mchid=" + url.QueryEscape(client.MchID)
+
+	var respObject WxV3OrderQueryResponse
+	err = client.doRequest(http.MethodGet, path, nil, &respObject)
+	if err != nil {
+		return nil, err
+	}
+
+	// OrderQueryObject
+	object := &OrderQueryObject{
+		OrderID:         respObject.OutTradeNo,
+		Status:          mapTradeStateToStatus[respObject.TradeState],
+		PayTime:         getV3Time(respObject.SuccessTime),
+		ThirdOrderID:    respObject.TransactionID,
+		Attach:          respObject.Attach,
+		OrderQueryParam: orderQueryParam,
+	}
+	if respObject.Amount != nil {
+		object.ThirdOrderFee = respObject.Amount.Total
+		object.CashFee = respObject.Amount.PayerTotal
+	}
+	fillV3OrderQueryFees(object, respObject.PromotionDetail)
+	return object, nil
+}
+
+// CloseOrder 关闭订单 https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter3_2_3.shtml
+func (client *WxV3Client) CloseOrder(closeOrderParam *CloseOrderParam) (*CloseOrderObject, error) {
+	err := checkV3SubMerchant(closeOrderParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf(V3CloseOrderPath, url.PathEscape(closeOrderParam.OrderID))
+	body := map[string]interface{}{
+		"mchid": client.MchID, // 【必传】直连商户号
+	}
+
+	err = client.doRequest(http.MethodPost, path, body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// CloseOrderObject
+	object := &CloseOrderObject{
+		OrderID:         closeOrderParam.OrderID,
+		Status:          OrderClosed,
+		CloseOrderParam: closeOrderParam,
+	}
+	return object, nil
+}
+
+// Refund 退款 https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter3_2_9.shtml
+func (client *WxV3Client) Refund(refundParam *RefundParam) (*RefundObject, error) {
+	err := checkV3SubMerchant(refundParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"out_trade_no":  refundParam.OrderID,     // 【必传】原支付交易对应的商户订单号
+		"out_refund_no": refundParam.RefundID,    // 【必传】商户系统内部的退款单号
+		"reason":        refundParam.RefundDesc,  // 【非必传】退款原因
+		"notify_url":    refundParam.CallbackURL, // 【非必传】退款结果回调url
+		"amount": map[string]interface{}{ // 【必传】金额信息
+			"refund":   refundParam.RefundFee, // 退款金额，单位为分
+			"total":    refundParam.OrderFee,  // 原订单金额，单位为分
+			"currency": V3Currency,            // CNY：人民币
+		},
+	}
+
+	var respObject WxV3RefundResponse
+	err = client.doRequest(http.MethodPost, V3RefundPath, body, &respObject)
+	if err != nil {
+		return nil, err
+	}
+
+	// RefundObject
+	object := &RefundObject{
+		OrderID:       respObject.OutTradeNo,
+		RefundID:      respObject.OutRefundNo,
+		Status:        OrderRefunding,
+		ThirdOrderID:  respObject.TransactionID,
+		ThirdRefundID: respObject.RefundID,
+		RefundParam:   refundParam,
+	}
+	if status, ok := mapV3RefundStatusToStatus[respObject.Status]; ok {
+		object.Status = status
+	}
+	if respObject.Amount != nil {
+		object.ThirdOrderFee = respObject.Amount.Total
+		object.ThirdRefundFee = respObject.Amount.Refund
+	}
+	return object, nil
+}
+
+// RefundQuery 退款查询 https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter3_2_10.shtml
+func (client *WxV3Client) RefundQuery(refundQueryParam *RefundQueryParam) (*RefundQueryObject, error) {
+	err := checkV3SubMerchant(refundQueryParam.SubMerchant)
+	if err != nil {
+		return nil, err
+	}
+	if IsEmpty(refundQueryParam.RefundID) {
+		return nil, errors.New("wx v3 refund query, refundID is required")
+	}
+
+	path := fmt.Sprintf(V3RefundQueryPath, url.PathEscape(refundQueryParam.RefundID))
+
+	var respObject WxV3RefundResponse
+	err = client.doRequest(http.MethodGet, path, nil, &respObject)
+	if err != nil {
+		return nil, err
+	}
+
+	// RefundQueryObject
+	object := &RefundQueryObject{
+		OrderID:           respObject.OutTradeNo,
+		RefundID:          respObject.OutRefundNo,
+		Status:            OrderRefunding,
+		ThirdOrderID:      respObject.TransactionID,
+		ThirdRefundID:     respObject.RefundID,
+		RefundTime:        getV3Time(respObject.SuccessTime),
+		RefundRecvAccount: respObject.UserReceivedAccount,
+		RefundQueryParam:  refundQueryParam,
+	}
+	if status, ok := mapV3RefundStatusToStatus[respObject.Status]; ok {
+		object.Status = status
+	}
+	if respObject.Amount != nil {
+		object.ThirdOrderFee = respObject.Amount.Total
+		object.ThirdRefundFee = respObject.Amount.Refund
+		object.SettlementRefundFee = respObject.Amount.SettlementRefund
+	}
+	return object, nil
+}
+
+//===================================================
+//		 Request; Sign; Verify; Certificates
+//===================================================
+// APIv3退款状态和Status映射
+var mapV3RefundStatusToStatus = map[string]int64{
+	"SUCCESS":    OrderRefundSuccess, // 8: 退款成功
+	"PROCESSING": OrderRefunding,     // 7: 退款处理中
+	"ABNORMAL":   OrderRefundFail,    // 9: 退款异常
+	"CLOSED":     OrderRefundFail,    // 9: 退款关闭
+}
+
+// 优惠详情，免充值型代金券(NOCASH)从应结订单金额中扣除，与v2的settlement_total_fee一致
+func fillV3OrderQueryFees(object *OrderQueryObject, promotionDetail []*WxV3PromotionDetail) {
+	object.SettlementFee = object.ThirdOrderFee
+	for _, promotion := range promotionDetail {
+		object.DiscountFee += promotion.Amount
+		if promotion.Type == "NOCASH" {
+			object.SettlementFee -= promotion.Amount
+		}
+		object.Discounts = append(object.Discounts, &Discount{
+			ID:          promotion.CouponID,
+			Type:        promotion.Type,
+			Name:        promotion.Name,
+			Fee:         promotion.Amount,
+			MerchantFee: promotion.MerchantContribute,
+			OtherFee:    promotion.WechatpayContribute + promotion.OtherContribute,
+		})
+	}
+}
+
+// APIv3客户端仅支持直连商户，服务商模式的子商户参数会被忽略，直接拒绝
+func checkV3SubMerchant(subMerchant SubMerchant) error {
+	if IsNotEmpty(subMerchant.SubMchID) || IsNotEmpty(subMerchant.SubAppID) {
+		return errors.New("wx v3 not support subMerchant")
+	}
+	return nil
+}
+
+// 请求，并使用平台证书验证响应签名
+func (client *WxV3Client) doRequest(method string, path string, body interface{}, respObject interface{}) error {
+	header, respBody, err := client.request(method, path, body)
+	if err != nil {
+		return err
+	}
+
+	cert, err := client.getPlatformCert(header.Get("Wechatpay-Serial"))
+	if err != nil {
+		return err
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("wx v3 platform public key is not rsa key")
+	}
+	err = verifyV3Response(publicKey, header, respBody)
+	if err != nil {
+		return err
+	}
+
+	if respObject == nil || len(respBody) == 0 { // 关闭订单等接口无返回内容
+		return nil
+	}
+	return json.Unmarshal(respBody, respObject)
+}
+
+// 请求，返回响应头和响应内容，请求失败时返回微信支付的错误信息
+func (client *WxV3Client) request(method string, path string, body interface{}) (http.Header, []byte, error) {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	authorization, err := client.authorization(method, path, reqBody)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest(method, V3ApiDomain+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", MIMEApplicationJSON)
+	req.Header.Set("Content-Type", MIMEApplicationJSON)
+	req.Header.Set("User-Agent", "gopay")
+
+	hc := &http.Client{}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		var errObject WxV3ErrorResponse
+		if json.Unmarshal(respBody, &errObject) != nil || IsEmpty(errObject.Code) {
+			return nil, nil, errors.New(fmt.Sprintf("wx v3 request fail, status: %d", resp.StatusCode))
+		}
+		return nil, nil, errors.New(errObject.Code + ", " + errObject.Message)
+	}
+	return resp.Header, respBody, nil
+}
+
+// Authorization头 WECHATPAY2-SHA256-RSA2048 mchid="",nonce_str="",signature="",timestamp="",serial_no=""
+func (client *WxV3Client) authorization(method string, path string, body []byte) (string, error) {
+	nonceStr := NonceStr()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature, err := client.sign(method, path, timestamp, nonceStr, string(body))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`%s mchid="%s",nonce_str="%s",signature="%s",timestamp="%s",serial_no="%s"`,
+		V3AuthSchema, client.MchID, nonceStr, signature, timestamp, client.MchCertSerialNo), nil
+}
+
+// 签名，每个字段以\n结尾，使用商户API私钥SHA256withRSA签名后Base64编码
+func (client *WxV3Client) sign(fields ...string) (string, error) {
+	privateKey, err := client.getPrivateKey()
+	if err != nil {
+		return "", err
+	}
+
+	message := strings.Join(fields, "\n") + "\n"
+	hashed := sha256.Sum256([]byte(message))
+	signBytes, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signBytes), nil
+}
+
+func (client *WxV3Client) getPrivateKey() (*rsa.PrivateKey, error) {
+	client.keyMu.Lock()
+	defer client.keyMu.Unlock()
+
+	if client.privateKey != nil {
+		return client.privateKey, nil
+	}
+
+	block, _ := pem.Decode(client.MchPrivateKey)
+	if block == nil {
+		return nil, errors.New("merchant private key block error")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		privateKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("merchant private key is not rsa key")
+		}
+		client.privateKey = privateKey
+	} else if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		client.privateKey = privateKey
+	} else {
+		return nil, errors.New("merchant private key is incorrect")
+	}
+	return client.privateKey, nil
+}
+
+// 获取平台证书，缓存过期或证书序列号不存在时重新下载
+func (client *WxV3Client) getPlatformCert(serialNo string) (*x509.Certificate, error) {
+	client.certMu.Lock()
+	defer client.certMu.Unlock()
+
+	if cert, ok := client.platformCerts[serialNo]; ok && time.Now().Before(client.platformCertsExpireAt) {
+		return cert, nil
+	}
+
+	certs, err := client.downloadPlatformCerts()
+	if err != nil {
+		return nil, err
+	}
+	client.platformCerts = certs
+	client.platformCertsExpireAt = time.Now().Add(v3PlatformCertsTTL)
+
+	cert, ok := certs[serialNo]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("wx v3 platform certificate not found, serial no: %s", serialNo))
+	}
+	return cert, nil
+}
+
+// 下载平台证书 https://pay.weixin.qq.com/wiki/doc/apiv3/apis/wechatpay5_1.shtml
+// 证书使用APIv3密钥解密；设置了PlatformCert时响应签名使用PlatformCert验证，否则使用下载的平台证书验证
+func (client *WxV3Client) downloadPlatformCerts() (map[string]*x509.Certificate, error) {
+	header, respBody, err := client.request(http.MethodGet, V3CertificatesPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var respObject WxV3CertificatesResponse
+	err = json.Unmarshal(respBody, &respObject)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make(map[string]*x509.Certificate)
+	for _, item := range respObject.Data {
+		if item.EncryptCertificate == nil {
+			continue
+		}
+		certPem, err := client.decrypt(item.EncryptCertificate)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(certPem)
+		if block == nil {
+			return nil, errors.New("wx v3 platform certificate block error")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs[item.SerialNo] = cert
+	}
+
+	publicKey, err := client.getPlatformPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if publicKey == nil { // 未设置PlatformCert，只能使用下载的平台证书自验
+		cert, ok := certs[header.Get("Wechatpay-Serial")]
+		if !ok {
+			return nil, errors.New("wx v3 platform certificate not found")
+		}
+		if publicKey, ok = cert.PublicKey.(*rsa.PublicKey); !ok {
+			return nil, errors.New("wx v3 platform public key is not rsa key")
+		}
+	}
+	err = verifyV3Response(publicKey, header, respBody)
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// 解析PlatformCert，支持平台证书和平台公钥，未设置时返回nil
+func (client *WxV3Client) getPlatformPublicKey() (*rsa.PublicKey, error) {
+	client.keyMu.Lock()
+	defer client.keyMu.Unlock()
+
+	if client.platformPublicKey != nil || len(client.PlatformCert) == 0 {
+		return client.platformPublicKey, nil
+	}
+
+	block, _ := pem.Decode(client.PlatformCert)
+	if block == nil {
+		return nil, errors.New("wx v3 platform certificate block error")
+	}
+	var publicKey interface{}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		publicKey = cert.PublicKey
+	} else {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		publicKey = key
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("wx v3 platform public key is not rsa key")
+	}
+	client.platformPublicKey = rsaPublicKey
+	return client.platformPublicKey, nil
+}
+
+// 解密 AEAD_AES_256_GCM
+func (client *WxV3Client) decrypt(resource *WxV3EncryptResource) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(resource.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return AesGcmDecrypt([]byte(client.ApiV3Key), []byte(resource.Nonce), []byte(resource.AssociatedData), ciphertext)
+}
+
+// 验证响应签名，验签串为 时间戳\n随机串\n响应报文主体\n
+// 时间戳与当前时间相差超过v3TimestampTolerance时拒绝，防止重放
+func verifyV3Response(publicKey *rsa.PublicKey, header http.Header, body []byte) error {
+	timestamp, err := strconv.ParseInt(header.Get("Wechatpay-Timestamp"), 10, 64)
+	if err != nil {
+		return ErrSignVerifyFail
+	}
+	if offset := time.Since(time.Unix(timestamp, 0)); offset > v3TimestampTolerance || offset < -v3TimestampTolerance {
+		return errors.New("wx v3 response timestamp expired")
+	}
+	signBytes, err := base64.StdEncoding.DecodeString(header.Get("Wechatpay-Signature"))
+	if err != nil {
+		return ErrSignVerifyFail
+	}
+
+	message := header.Get("Wechatpay-Timestamp") + "\n" + header.Get("Wechatpay-Nonce") + "\n" + string(body) + "\n"
+	hashed := sha256.Sum256([]byte(message))
+	if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signBytes) != nil {
+		return ErrSignVerifyFail
+	}
+	return nil
+}
+
+// 获取APIv3时间 格式为RFC3339 2018-06-08T10:34:56+08:00
+func getV3Time(value string) *time.Time {
+	var result time.Time
+	if IsNotEmpty(value) {
+		result, _ = time.Parse(time.RFC3339, value)
+	}
+	return &result
+}
+
+// 商品详情，APIv3字段名与v2不同
+func toV3Detail(orderDetail *OrderDetail) map[string]interface{} {
+	var goodsDetail []map[string]interface{}
+	for _, goods := range orderDetail.GoodsDetail {
+		item := map[string]interface{}{
+			"merchant_goods_id": goods.GoodsID,  // 【必传】商户侧商品编码
+			"quantity":          goods.Quantity, // 【必传】商品数量
+			"unit_price":        goods.Price,    // 【必传】商品单价，单位为分
+		}
+		if IsNotEmpty(goods.ThirdGoodsID) {
+			item["wechatpay_goods_id"] = goods.ThirdGoodsID // 【非必传】微信支付商品编码
+		}
+		if IsNotEmpty(goods.GoodsName) {
+			item["goods_name"] = goods.GoodsName // 【非必传】商品名称
+		}
+		goodsDetail = append(goodsDetail, item)
+	}
+
+	detail := map[string]interface{}{
+		"goods_detail": goodsDetail, // 【非必传】单品列表
+	}
+	if orderDetail.CostPrice > 0 {
+		detail["cost_price"] = orderDetail.CostPrice // 【非必传】订单原价
+	}
+	if IsNotEmpty(orderDetail.ReceiptID) {
+		detail["invoice_id"] = orderDetail.ReceiptID // 【非必传】商品小票ID
+	}
+	return detail
+}
@@ -0,0 +1,236 @@
+package wx
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	. "github.com/bmbstack/gopay/common"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestV3Client(t *testing.T) (*WxV3Client, *rsa.PrivateKey) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &WxV3Client{
+		MchID:           "1900009191",
+		MchCertSerialNo: "1DDE55AD98ED71D6EDD4A4A16996DE7B47773A8C",
+		MchPrivateKey:   pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}),
+	}
+	return client, privateKey
+}
+
+func verifyTestSign(publicKey *rsa.PublicKey, message string, signature string) error {
+	signBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(message))
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signBytes)
+}
+
+func TestWxV3ClientSign(t *testing.T) {
+	client, privateKey := newTestV3Client(t)
+
+	// 微信支付APIv3签名生成文档中的示例
+	tests := []struct {
+		name    string
+		fields  []string
+		message string
+	}{
+		{
+			"get certificates",
+			[]string{"GET", "/v3/certificates", "1554208460", "593BEC0C930BF1AFEB40B4A08C8FB242", ""},
+			"GET\n/v3/certificates\n1554208460\n593BEC0C930BF1AFEB40B4A08C8FB242\n\n",
+		},
+		{
+			"jsapi pay sign",
+			[]string{"wx8888888888888888", "1414561699", "5K8264ILTKCH16CQ2502SI8ZNMTM67VS", "prepay_id=wx201410272009395522657a690389285100"},
+			"wx8888888888888888\n1414561699\n5K8264ILTKCH16CQ2502SI8ZNMTM67VS\nprepay_id=wx201410272009395522657a690389285100\n",
+		},
+	}
+	for _, tt := range tests {
+		signature, err := client.sign(tt.fields...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := verifyTestSign(&privateKey.PublicKey, tt.message, signature); err != nil {
+			t.Errorf("%s: signature does not match message %q: %v", tt.name, tt.message, err)
+		}
+	}
+
+	// PKCS1格式的商户私钥
+	client.privateKey = nil
+	client.MchPrivateKey = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	signature, err := client.sign(tests[0].fields...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyTestSign(&privateKey.PublicKey, tests[0].message, signature); err != nil {
+		t.Errorf("pkcs1: %v", err)
+	}
+}
+
+func TestWxV3ClientAuthorization(t *testing.T) {
+	client, privateKey := newTestV3Client(t)
+	body := []byte(`{"appid":"wxd678efh567hg6787","mchid":"1900009191"}`)
+
+	authorization, err := client.authorization(http.MethodPost, V3TransactionsJsapiPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pattern := regexp.MustCompile(`^WECHATPAY2-SHA256-RSA2048 mchid="([^"]*)",nonce_str="([^"]*)",signature="([^"]*)",timestamp="([^"]*)",serial_no="([^"]*)"$`)
+	matches := pattern.FindStringSubmatch(authorization)
+	if matches == nil {
+		t.Fatalf("unexpected authorization: %s", authorization)
+	}
+	mchID, nonceStr, signature, timestamp, serialNo := matches[1], matches[2], matches[3], matches[4], matches[5]
+	if mchID != client.MchID || serialNo != client.MchCertSerialNo || nonceStr == "" {
+		t.Errorf("unexpected authorization: %s", authorization)
+	}
+	message := "POST\n" + V3TransactionsJsapiPath + "\n" + timestamp + "\n" + nonceStr + "\n" + string(body) + "\n"
+	if err := verifyTestSign(&privateKey.PublicKey, message, signature); err != nil {
+		t.Errorf("authorization signature: %v", err)
+	}
+}
+
+func TestVerifyV3Response(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"prepay_id":"wx201410272009395522657a690389285100"}`)
+	nonce := "c5ac7061fccab6bf3e254dcf98995b8c"
+
+	header := func(timestamp time.Time, body []byte) http.Header {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		hashed := sha256.Sum256([]byte(ts + "\n" + nonce + "\n" + string(body) + "\n"))
+		signBytes, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := http.Header{}
+		h.Set("Wechatpay-Timestamp", ts)
+		h.Set("Wechatpay-Nonce", nonce)
+		h.Set("Wechatpay-Signature", base64.StdEncoding.EncodeToString(signBytes))
+		return h
+	}
+	now := time.Now()
+	missingSignature := header(now, body)
+	missingSignature.Del("Wechatpay-Signature")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		publicKey *rsa.PublicKey
+		header    http.Header
+		body      []byte
+		wantErr   bool
+	}{
+		{"valid", &privateKey.PublicKey, header(now, body), body, false},
+		{"clock skew within tolerance", &privateKey.PublicKey, header(now.Add(-4*time.Minute), body), body, false},
+		{"tampered body", &privateKey.PublicKey, header(now, body), []byte(`{"prepay_id":"other"}`), true},
+		{"other platform key", &otherKey.PublicKey, header(now, body), body, true},
+		{"missing signature", &privateKey.PublicKey, missingSignature, body, true},
+		{"stale timestamp", &privateKey.PublicKey, header(now.Add(-6*time.Minute), body), body, true},
+		{"future timestamp", &privateKey.PublicKey, header(now.Add(6*time.Minute), body), body, true},
+	}
+	for _, tt := range tests {
+		err := verifyV3Response(tt.publicKey, tt.header, tt.body)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWxV3ClientPlatformPublicKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Tenpay.com Root CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		platformCert []byte
+		wantNil      bool
+		wantErr      bool
+	}{
+		{"not set", nil, true, false},
+		{"certificate", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), false, false},
+		{"public key", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes}), false, false},
+		{"invalid", []byte("not a pem"), true, true},
+	}
+	for _, tt := range tests {
+		client := &WxV3Client{PlatformCert: tt.platformCert}
+		publicKey, err := client.getPlatformPublicKey()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if (publicKey == nil) != tt.wantNil {
+			t.Errorf("%s: publicKey = %v, wantNil %v", tt.name, publicKey, tt.wantNil)
+			continue
+		}
+		if publicKey != nil && publicKey.N.Cmp(privateKey.PublicKey.N) != 0 {
+			t.Errorf("%s: unexpected public key", tt.name)
+		}
+	}
+}
+
+func TestFillV3OrderQueryFees(t *testing.T) {
+	body := `{"amount":{"total":100,"payer_total":80,"currency":"CNY","payer_currency":"CNY"},
+		"promotion_detail":[
+			{"coupon_id":"109519","name":"单品惠-6","scope":"SINGLE","type":"NOCASH","amount":15,"stock_id":"931386","wechatpay_contribute":0,"merchant_contribute":15,"other_contribute":0},
+			{"coupon_id":"109520","name":"全场券","scope":"GLOBAL","type":"CASH","amount":5,"stock_id":"931387","wechatpay_contribute":5,"merchant_contribute":0,"other_contribute":0}
+		]}`
+	var respObject WxV3OrderQueryResponse
+	if err := json.Unmarshal([]byte(body), &respObject); err != nil {
+		t.Fatal(err)
+	}
+
+	object := &OrderQueryObject{ThirdOrderFee: respObject.Amount.Total, CashFee: respObject.Amount.PayerTotal}
+	fillV3OrderQueryFees(object, respObject.PromotionDetail)
+	if object.CashFee != 80 || object.DiscountFee != 20 || object.SettlementFee != 85 || len(object.Discounts) != 2 {
+		t.Fatalf("unexpected fees: %+v", object)
+	}
+	if discount := object.Discounts[0]; discount.ID != "109519" || discount.Fee != 15 || discount.MerchantFee != 15 || discount.OtherFee != 0 {
+		t.Errorf("unexpected discount: %+v", discount)
+	}
+	if discount := object.Discounts[1]; discount.Type != "CASH" || discount.MerchantFee != 0 || discount.OtherFee != 5 {
+		t.Errorf("unexpected discount: %+v", discount)
+	}
+}
@@ -0,0 +1,138 @@
+package wx
+
+import "time"
+
+const (
+	V3AuthSchema        = "WECHATPAY2-SHA256-RSA2048" // 签名认证类型
+	V3SignTypeRSA       = "RSA"                       // APIv3调起支付的签名类型
+	V3Currency          = "CNY"                       // 货币类型，境内商户号仅支持人民币
+	MIMEApplicationJSON = "application/json"
+
+	V3ApiDomain = "https://api.mch.weixin.qq.com"
+
+	V3CertificatesPath       = "/v3/certificates"                           // 获取平台证书列表
+	V3TransactionsAppPath    = "/v3/pay/transactions/app"                   // APP下单
+	V3TransactionsJsapiPath  = "/v3/pay/transactions/jsapi"                 // JSAPI/小程序下单
+	V3TransactionsNativePath = "/v3/pay/transactions/native"                // Native下单
+	V3TransactionsH5Path     = "/v3/pay/transactions/h5"                    // H5下单
+	V3OrderQueryPath         = "/v3/pay/transactions/out-trade-no/%s"       // 商户订单号查询
+	V3CloseOrderPath         = "/v3/pay/transactions/out-trade-no/%s/close" // 关闭订单
+	V3RefundPath             = "/v3/refund/domestic/refunds"                // 申请退款
+	V3RefundQueryPath        = "/v3/refund/domestic/refunds/%s"             // 查询单笔退款
+
+	v3PlatformCertsTTL   = 12 * time.Hour  // 平台证书缓存时间，微信建议定期更新平台证书
+	v3TimestampTolerance = 5 * time.Minute // 响应签名时间戳允许的误差
+)
+
+//=================================================================
+//							[Response]APIv3通用参数
+//=================================================================
+// WxV3ErrorResponse 请求失败时返回的错误信息
+type WxV3ErrorResponse struct {
+	Code    string `json:"code"`    // 详细错误码
+	Message string `json:"message"` // 错误描述
+}
+
+// WxV3Amount 订单金额
+type WxV3Amount struct {
+	Total         int64  `json:"total"`          // 订单总金额，单位为分
+	PayerTotal    int64  `json:"payer_total"`    // 用户支付金额，单位为分
+	Currency      string `json:"currency"`       // 货币类型
+	PayerCurrency string `json:"payer_currency"` // 用户支付币种
+}
+
+//=================================================================
+//							[Response]平台证书
+//=================================================================
+type WxV3CertificatesResponse struct {
+	Data []*WxV3Certificate `json:"data"`
+}
+
+type WxV3Certificate struct {
+	SerialNo           string               `json:"serial_no"`           // 证书序列号
+	EffectiveTime      string               `json:"effective_time"`      // 证书启用时间
+	ExpireTime         string               `json:"expire_time"`         // 证书弃用时间
+	EncryptCertificate *WxV3EncryptResource `json:"encrypt_certificate"` // 证书信息，使用APIv3密钥加密
+}
+
+// WxV3EncryptResource 加密数据，AEAD_AES_256_GCM
+type WxV3EncryptResource struct {
+	Algorithm      string `json:"algorithm"`       // 加密算法类型 AEAD_AES_256_GCM
+	Nonce          string `json:"nonce"`           // 加密使用的随机串
+	AssociatedData string `json:"associated_data"` // 附加数据
+	Ciphertext     string `json:"ciphertext"`      // Base64编码后的密文
+}
+
+//=================================================================
+//							[Response]APIv3下单
+//=================================================================
+type WxV3OrderResponse struct {
+	PrepayID string `json:"prepay_id"` // 【APP/JSAPI】预支付交易会话标识，有效期为2小时
+	CodeURL  string `json:"code_url"`  // 【NATIVE】二维码链接
+	H5URL    string `json:"h5_url"`    // 【H5】支付跳转链接，有效期为5分钟
+}
+
+//=================================================================
+//							[Response]APIv3查询订单
+//=================================================================
+type WxV3OrderQueryResponse struct {
+	AppID          string      `json:"appid"`            // 应用ID
+	MchID          string      `json:"mchid"`            // 商户号
+	OutTradeNo     string      `json:"out_trade_no"`     // 商户订单号
+	TransactionID  string      `json:"transaction_id"`   // 微信支付订单号
+	TradeType      string      `json:"trade_type"`       // 交易类型 JSAPI/NATIVE/APP/MICROPAY/MWEB/FACEPAY
+	TradeState     string      `json:"trade_state"`      // 交易状态 SUCCESS/REFUND/NOTPAY/CLOSED/REVOKED/USERPAYING/PAYERROR
+	TradeStateDesc string      `json:"trade_state_desc"` // 交易状态描述
+	BankType       string      `json:"bank_type"`        // 付款银行
+	Attach         string      `json:"attach"`           // 附加数据
+	SuccessTime    string      `json:"success_time"`     // 支付完成时间 2018-06-08T10:34:56+08:00
+	Payer          *WxV3Payer  `json:"payer"`            // 支付者
+	Amount         *WxV3Amount `json:"amount"`           // 订单金额
+
+	PromotionDetail []*WxV3PromotionDetail `json:"promotion_detail"` // 优惠功能，享受优惠时返回
+}
+
+type WxV3Payer struct {
+	OpenID string `json:"openid"` // 用户在直连商户appid下的唯一标识
+}
+
+// WxV3PromotionDetail 优惠详情
+type WxV3PromotionDetail struct {
+	CouponID            string `json:"coupon_id"`            // 券ID
+	Name                string `json:"name"`                 // 优惠名称
+	Scope               string `json:"scope"`                // 优惠范围 GLOBAL—全场代金券, SINGLE—单品优惠
+	Type                string `json:"type"`                 // 优惠类型 CASH—充值型代金券, NOCASH—免充值型代金券
+	Amount              int64  `json:"amount"`               // 优惠券面额，单位为分
+	StockID             string `json:"stock_id"`             // 活动ID
+	WechatpayContribute int64  `json:"wechatpay_contribute"` // 微信出资，单位为分
+	MerchantContribute  int64  `json:"merchant_contribute"`  // 商户出资，单位为分
+	OtherContribute     int64  `json:"other_contribute"`     // 其他出资，单位为分
+	Currency            string `json:"currency"`             // 优惠币种
+}
+
+//=================================================================
+//							[Response]APIv3退款、查询单笔退款
+//=================================================================
+type WxV3RefundResponse struct {
+	RefundID            string            `json:"refund_id"`             // 微信支付退款单号
+	OutRefundNo         string            `json:"out_refund_no"`         // 商户退款单号
+	TransactionID       string            `json:"transaction_id"`        // 微信支付订单号
+	OutTradeNo          string            `json:"out_trade_no"`          // 商户订单号
+	Channel             string            `json:"channel"`               // 退款渠道 ORIGINAL/BALANCE/OTHER_BALANCE/OTHER_BANKCARD
+	UserReceivedAccount string            `json:"user_received_account"` // 退款入账账户
+	SuccessTime         string            `json:"success_time"`          // 退款成功时间
+	CreateTime          string            `json:"create_time"`           // 退款创建时间
+	Status              string            `json:"status"`                // 退款状态 SUCCESS/CLOSED/PROCESSING/ABNORMAL
+	Amount              *WxV3RefundAmount `json:"amount"`                // 金额信息
+}
+
+type WxV3RefundAmount struct {
+	Total            int64  `json:"total"`             // 订单总金额
+	Refund           int64  `json:"refund"`            // 退款金额
+	PayerTotal       int64  `json:"payer_total"`       // 用户支付金额
+	PayerRefund      int64  `json:"payer_refund"`      // 用户退款金额
+	SettlementRefund int64  `json:"settlement_refund"` // 应结退款金额
+	SettlementTotal  int64  `json:"settlement_total"`  // 应结订单金额
+	DiscountRefund   int64  `json:"discount_refund"`   // 优惠退款金额
+	Currency         string `json:"currency"`          // 退款币种
+}